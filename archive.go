@@ -0,0 +1,379 @@
+package inseki
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveSeparator : Separates the path of an archive from the path of a file inside it (course.zip!/TP1/main.c)
+const ArchiveSeparator = "!"
+
+// DefaultArchiveMaxSize : Archives bigger than this are not opened, unless ArchiveOptions.MaxSize says otherwise
+const DefaultArchiveMaxSize = 256 << 20
+
+// DefaultArchiveMaxOpen : Archives kept open at the same time, unless ArchiveOptions.MaxOpen says otherwise
+const DefaultArchiveMaxOpen = 4
+
+// ErrArchive : An archive could not be opened, the scan goes on without its content
+var ErrArchive = errors.New("unreadable archive")
+
+// ArchiveOptions : Options to scan inside .zip, .tar, .tar.gz and .tgz archives
+type ArchiveOptions struct {
+	Enabled  bool  `json:"enabled"`
+	MaxSize  int64 `json:"maxSize,omitempty"`  // In bytes, of the archive and of its content once read, DefaultArchiveMaxSize if 0
+	MaxDepth int   `json:"maxDepth,omitempty"` // Archives inside archives, 1 (no nesting) if 0
+
+	// Archives kept in memory at the same time (at most MaxSize bytes each), DefaultArchiveMaxOpen if 0
+	// The least recently used one is dropped, and read again if needed
+	MaxOpen int `json:"maxOpen,omitempty"`
+}
+
+// isArchive : Check if a file name has a supported archive extension
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, extension := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveFileSystem : Show the archives of a FileSystem as folders named "<archive>!", read in memory
+type archiveFileSystem struct {
+	base    FileSystem
+	options ArchiveOptions
+	depth   int
+
+	mu     sync.Mutex
+	opened map[string]*openedArchive
+	recent []string // Opened archives, the least recently used first
+}
+
+// openedArchive : An archive opened at most once
+type openedArchive struct {
+	once sync.Once
+	fsys FileSystem
+	err  error
+}
+
+// WithArchives : Wrap a FileSystem so archives can be explored like folders
+func WithArchives(base FileSystem, options ArchiveOptions) FileSystem {
+	if options.MaxSize == 0 {
+		options.MaxSize = DefaultArchiveMaxSize
+	}
+	if options.MaxDepth == 0 {
+		options.MaxDepth = 1
+	}
+	if options.MaxOpen == 0 {
+		options.MaxOpen = DefaultArchiveMaxOpen
+	}
+
+	return newArchiveFileSystem(base, options, 1)
+}
+
+func newArchiveFileSystem(base FileSystem, options ArchiveOptions, depth int) *archiveFileSystem {
+	return &archiveFileSystem{
+		base:    base,
+		options: options,
+		depth:   depth,
+		opened:  make(map[string]*openedArchive),
+	}
+}
+
+// split : Split a path at the first archive it goes through
+// "/a/course.zip!/TP1/main.c" -> "/a/course.zip", "TP1/main.c"
+func (a *archiveFileSystem) split(name string) (string, string, bool) {
+	name = filepath.ToSlash(name)
+
+	offset := 0
+	for {
+		i := strings.Index(name[offset:], ArchiveSeparator)
+		if i < 0 {
+			return "", "", false
+		}
+		i += offset
+
+		rest := name[i+len(ArchiveSeparator):]
+		if (rest == "" || strings.HasPrefix(rest, "/")) && isArchive(name[:i]) {
+			inner := strings.TrimPrefix(rest, "/")
+			if inner == "" {
+				inner = "."
+			}
+			return filepath.FromSlash(name[:i]), inner, true
+		}
+
+		offset = i + len(ArchiveSeparator)
+	}
+}
+
+// openArchive : Read an archive, only once while it stays among the MaxOpen most recently used ones
+func (a *archiveFileSystem) openArchive(archive string) (FileSystem, error) {
+	a.mu.Lock()
+	opened, ok := a.opened[archive]
+	if !ok {
+		opened = &openedArchive{}
+		a.opened[archive] = opened
+	}
+	a.use(archive)
+	a.mu.Unlock()
+
+	opened.once.Do(func() {
+		var fsys fs.FS
+		fsys, opened.err = a.read(archive)
+		if opened.err != nil {
+			opened.err = fmt.Errorf("%w: %s: %v", ErrArchive, archive, opened.err)
+			return
+		}
+
+		opened.fsys = newArchiveFileSystem(FromFS(fsys), a.options, a.depth+1)
+	})
+
+	return opened.fsys, opened.err
+}
+
+// use : Mark an archive as the most recently used, and drop the oldest ones past MaxOpen
+// Readers still holding a dropped archive keep it until they are done
+func (a *archiveFileSystem) use(archive string) {
+	for i, name := range a.recent {
+		if name == archive {
+			a.recent = append(a.recent[:i], a.recent[i+1:]...)
+			break
+		}
+	}
+	a.recent = append(a.recent, archive)
+
+	for len(a.recent) > a.options.MaxOpen {
+		delete(a.opened, a.recent[0])
+		a.recent = a.recent[1:]
+	}
+}
+
+// read : Load an archive in memory as an fs.FS (nothing is extracted to the disk)
+func (a *archiveFileSystem) read(archive string) (fs.FS, error) {
+	data, err := a.base.ReadFile(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(archive)
+
+	if strings.HasSuffix(lower, ".zip") {
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+
+		// A small zip can hold much more once read (zip bomb), what it declares is checked while reading
+		var total uint64
+		for _, file := range reader.File {
+			total += file.UncompressedSize64
+			if total > uint64(a.options.MaxSize) {
+				return nil, fmt.Errorf("content bigger than %d bytes", a.options.MaxSize)
+			}
+		}
+
+		return reader, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(data)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		reader, err = gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tarToZip(reader, a.options.MaxSize)
+}
+
+// tarToZip : Copy a tar stream into an uncompressed in-memory zip, which already is an fs.FS
+func tarToZip(reader io.Reader, maxSize int64) (fs.FS, error) {
+	buffer := &bytes.Buffer{}
+	writer := zip.NewWriter(buffer)
+
+	tarReader := tar.NewReader(reader)
+	var total int64
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		// A compressed archive can be much bigger once read
+		total += header.Size
+		if total > maxSize {
+			return nil, fmt.Errorf("content bigger than %d bytes", maxSize)
+		}
+
+		zipHeader := &zip.FileHeader{
+			Name:     strings.TrimPrefix(header.Name, "./"),
+			Method:   zip.Store,
+			Modified: header.ModTime,
+		}
+		zipHeader.SetMode(header.FileInfo().Mode())
+
+		file, err := writer.CreateHeader(zipHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(file, tarReader); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+}
+
+// canOpen : Check if an archive can be shown as a folder (nesting and size limits)
+func (a *archiveFileSystem) canOpen(info fs.FileInfo) bool {
+	return a.depth <= a.options.MaxDepth && info.Mode().IsRegular() &&
+		isArchive(info.Name()) && info.Size() <= a.options.MaxSize
+}
+
+func (a *archiveFileSystem) Stat(name string) (fs.FileInfo, error) {
+	if archive, inner, ok := a.split(name); ok {
+		fsys, err := a.openArchive(archive)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := fsys.Stat(inner)
+		if err != nil {
+			return nil, err
+		}
+
+		if inner == "." {
+			return archiveDirInfo{archive: info, name: filepath.Base(archive) + ArchiveSeparator}, nil
+		}
+		return info, nil
+	}
+
+	return a.base.Stat(name)
+}
+
+func (a *archiveFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return a.readDirLimit(name, 0)
+}
+
+// readDirLimit : ReadDir, reading at most n entries of the underlying folder if n > 0
+func (a *archiveFileSystem) readDirLimit(name string, n int) ([]fs.DirEntry, error) {
+	read := func(fsys FileSystem, name string) ([]fs.DirEntry, error) {
+		if n > 0 {
+			return readDirLimit(fsys, name, n)
+		}
+		return fsys.ReadDir(name)
+	}
+
+	if archive, inner, ok := a.split(name); ok {
+		fsys, err := a.openArchive(archive)
+		if err != nil {
+			return nil, err
+		}
+		return read(fsys, inner)
+	}
+
+	entries, err := read(a.base, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each archive is followed by a folder showing its content
+	results := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, entry)
+
+		if entry.IsDir() || !isArchive(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !a.canOpen(info) {
+			continue
+		}
+
+		results = append(results, archiveDirEntry{archiveDirInfo{archive: info, name: entry.Name() + ArchiveSeparator}})
+	}
+
+	return results, nil
+}
+
+func (a *archiveFileSystem) ReadFile(name string) ([]byte, error) {
+	if archive, inner, ok := a.split(name); ok {
+		fsys, err := a.openArchive(archive)
+		if err != nil {
+			return nil, err
+		}
+		return fsys.ReadFile(inner)
+	}
+
+	return a.base.ReadFile(name)
+}
+
+func (a *archiveFileSystem) open(name string) (io.ReadCloser, error) {
+	if archive, inner, ok := a.split(name); ok {
+		fsys, err := a.openArchive(archive)
+		if err != nil {
+			return nil, err
+		}
+		return openFile(fsys, inner)
+	}
+
+	return openFile(a.base, name)
+}
+
+// isArchiveDir : Check if an entry is the folder showing the content of an archive
+func isArchiveDir(info fs.FileInfo) bool {
+	name := info.Name()
+	return info.IsDir() && strings.HasSuffix(name, ArchiveSeparator) && isArchive(strings.TrimSuffix(name, ArchiveSeparator))
+}
+
+// ----------------------------- Virtual folder -----------------------------
+
+// archiveDirInfo : An archive seen as a folder
+type archiveDirInfo struct {
+	archive fs.FileInfo
+	name    string
+}
+
+func (i archiveDirInfo) Name() string       { return i.name }
+func (i archiveDirInfo) Size() int64        { return i.archive.Size() }
+func (i archiveDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i archiveDirInfo) ModTime() time.Time { return i.archive.ModTime() }
+func (i archiveDirInfo) IsDir() bool        { return true }
+func (i archiveDirInfo) Sys() any           { return nil }
+
+// archiveDirEntry : Directory entry of an archive seen as a folder
+type archiveDirEntry struct {
+	info archiveDirInfo
+}
+
+func (e archiveDirEntry) Name() string               { return e.info.Name() }
+func (e archiveDirEntry) IsDir() bool                { return true }
+func (e archiveDirEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e archiveDirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
@@ -0,0 +1,236 @@
+package inseki
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// zipArchive : Content of a zip file holding the files given
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// tarArchive : Content of a tar file holding the files given, gzipped if asked
+func tarArchive(t *testing.T, files map[string]string, gzipped bool) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	var output io.Writer = &buffer
+
+	var compressor *gzip.Writer
+	if gzipped {
+		compressor = gzip.NewWriter(&buffer)
+		output = compressor
+	}
+
+	writer := tar.NewWriter(output)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if compressor != nil {
+		compressor.Close()
+	}
+
+	return buffer.Bytes()
+}
+
+func archiveTestFS(t *testing.T) FileSystem {
+	files := map[string]string{"src/main.c": "int main() {}\n"}
+
+	return FromFS(fstest.MapFS{
+		"data/code.zip":    {Data: zipArchive(t, files)},
+		"data/code.tar":    {Data: tarArchive(t, files, false)},
+		"data/code.tar.gz": {Data: tarArchive(t, files, true)},
+		"data/code.tgz":    {Data: tarArchive(t, files, true)},
+		"data/broken.zip":  {Data: []byte("not a zip")},
+		"data/outer.zip":   {Data: zipArchive(t, map[string]string{"inner.zip": string(zipArchive(t, files))})},
+		"data/big.zip":     {Data: zipArchive(t, map[string]string{"big.txt": string(bytes.Repeat([]byte("x"), 4096))})},
+		"data/notes.txt":   {Data: []byte("notes")},
+		"data/zip.d/a.txt": {Data: []byte("a")},
+		"data/name.zip!":   {Data: []byte("a file named like an archive folder")},
+	})
+}
+
+func TestArchiveSplit(t *testing.T) {
+	a := newArchiveFileSystem(nil, ArchiveOptions{}, 1)
+
+	tests := []struct {
+		name    string
+		archive string
+		inner   string
+		ok      bool
+	}{
+		{"data/code.zip!/src/main.c", "data/code.zip", "src/main.c", true},
+		{"data/code.zip!", "data/code.zip", ".", true},
+		{"data/code.tar.gz!/src", "data/code.tar.gz", "src", true},
+		{"data/outer.zip!/inner.zip!/src", "data/outer.zip", "inner.zip!/src", true},
+		{"data/code.zip", "", "", false},
+		{"data/wow!/code.zip", "", "", false},
+		{"data/notes.txt!/a", "", "", false},
+		{"data/code.zip!x/a", "", "", false},
+	}
+
+	for _, test := range tests {
+		archive, inner, ok := a.split(test.name)
+		if archive != test.archive || inner != test.inner || ok != test.ok {
+			t.Errorf("split(%s) = %q %q %v, want %q %q %v", test.name, archive, inner, ok, test.archive, test.inner, test.ok)
+		}
+	}
+}
+
+func TestArchiveFileSystemRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ArchiveOptions
+		path    string
+		want    string
+		err     error
+	}{
+		{"zip", ArchiveOptions{}, "data/code.zip!/src/main.c", "int main() {}\n", nil},
+		{"tar", ArchiveOptions{}, "data/code.tar!/src/main.c", "int main() {}\n", nil},
+		{"tar.gz", ArchiveOptions{}, "data/code.tar.gz!/src/main.c", "int main() {}\n", nil},
+		{"tgz", ArchiveOptions{}, "data/code.tgz!/src/main.c", "int main() {}\n", nil},
+		{"outside the archives", ArchiveOptions{}, "data/notes.txt", "notes", nil},
+		{"missing in the archive", ArchiveOptions{}, "data/code.zip!/missing", "", fs.ErrNotExist},
+		{"broken archive", ArchiveOptions{}, "data/broken.zip!/a", "", ErrArchive},
+		{"content too big", ArchiveOptions{MaxSize: 1024}, "data/big.zip!/big.txt", "", ErrArchive},
+		{"nested", ArchiveOptions{MaxDepth: 2}, "data/outer.zip!/inner.zip!/src/main.c", "int main() {}\n", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := WithArchives(archiveTestFS(t), test.options)
+
+			data, err := fsys.ReadFile(test.path)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Errorf("ReadFile(%s) = %v, want %v", test.path, err, test.err)
+				}
+				return
+			}
+			if err != nil || string(data) != test.want {
+				t.Fatalf("ReadFile(%s) = %q, %v, want %q", test.path, data, err, test.want)
+			}
+
+			// Streamed the same way
+			reader, err := openFile(fsys, test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			if data, err := io.ReadAll(reader); err != nil || string(data) != test.want {
+				t.Errorf("openFile(%s) = %q, %v, want %q", test.path, data, err, test.want)
+			}
+		})
+	}
+}
+
+func TestArchiveFileSystemReadDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ArchiveOptions
+		dir     string
+		want    []string
+	}{
+		{"archives followed by their folder", ArchiveOptions{}, "data", []string{
+			"big.zip", "big.zip!/", "broken.zip", "broken.zip!/", "code.tar", "code.tar!/", "code.tar.gz", "code.tar.gz!/", "code.tgz", "code.tgz!/",
+			"code.zip", "code.zip!/", "name.zip!", "notes.txt", "outer.zip", "outer.zip!/", "zip.d/",
+		}},
+		{"archives too big left as files", ArchiveOptions{MaxSize: 1024}, "data", []string{
+			"big.zip", "big.zip!/", "broken.zip", "broken.zip!/", "code.tar", "code.tar.gz", "code.tar.gz!/", "code.tgz", "code.tgz!/",
+			"code.zip", "code.zip!/", "name.zip!", "notes.txt", "outer.zip", "outer.zip!/", "zip.d/",
+		}},
+		{"inside an archive", ArchiveOptions{}, "data/code.zip!", []string{"src/"}},
+		{"nested, too deep", ArchiveOptions{}, "data/outer.zip!", []string{"inner.zip"}},
+		{"nested", ArchiveOptions{MaxDepth: 2}, "data/outer.zip!", []string{"inner.zip", "inner.zip!/"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := WithArchives(archiveTestFS(t), test.options)
+
+			entries, err := fsys.ReadDir(test.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() {
+					name += "/"
+				}
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ReadDir(%s) = %q, want %q", test.dir, got, test.want)
+			}
+		})
+	}
+}
+
+func TestArchiveFileSystemStat(t *testing.T) {
+	fsys := WithArchives(archiveTestFS(t), ArchiveOptions{})
+
+	info, err := fsys.Stat("data/code.zip!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || !isArchiveDir(info) || info.Name() != "code.zip!" {
+		t.Errorf("archive folder: dir %v, name %s", info.IsDir(), info.Name())
+	}
+
+	info, err = fsys.Stat("data/code.zip!/src/main.c")
+	if err != nil || info.IsDir() || info.Size() != int64(len("int main() {}\n")) {
+		t.Errorf("file in the archive: %v, %v", info, err)
+	}
+}
+
+func TestArchiveFileSystemMaxOpen(t *testing.T) {
+	fsys := WithArchives(archiveTestFS(t), ArchiveOptions{MaxOpen: 2}).(*archiveFileSystem)
+
+	for _, archive := range []string{"data/code.zip", "data/code.tar", "data/code.zip", "data/code.tgz"} {
+		if _, err := fsys.ReadFile(archive + "!/src/main.c"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// code.tar is the least recently used one
+	if want := []string{"data/code.zip", "data/code.tgz"}; !reflect.DeepEqual(fsys.recent, want) || len(fsys.opened) != 2 {
+		t.Errorf("archives kept %v (%d opened), want %v", fsys.recent, len(fsys.opened), want)
+	}
+}
@@ -0,0 +1,137 @@
+package inseki
+
+import (
+	"io/fs"
+	"sync"
+	"sync/atomic"
+)
+
+// ----------------------------- Directory cache -----------------------------
+
+// dirListing : A single cached directory listing, read at most once
+type dirListing struct {
+	once    sync.Once
+	entries []fs.DirEntry
+	err     error
+}
+
+// DirCache : Concurrency-safe cache of directory listings shared by every matching goroutine
+type DirCache struct {
+	fsys FileSystem
+
+	mu       sync.Mutex
+	listings map[string]*dirListing
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewDirCache : Create an empty directory cache, reading folders from fsys
+func NewDirCache(fsys FileSystem) *DirCache {
+	return &DirCache{
+		fsys:     fsys,
+		listings: make(map[string]*dirListing),
+	}
+}
+
+// ReadDir : Return the entries of a directory, reading it from the disk only once
+func (c *DirCache) ReadDir(path string) ([]fs.DirEntry, error) {
+	c.mu.Lock()
+	listing, ok := c.listings[path]
+	if !ok {
+		listing = &dirListing{}
+		c.listings[path] = listing
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
+	// Goroutines asking for the same directory wait for the first read
+	listing.once.Do(func() {
+		listing.entries, listing.err = c.fsys.ReadDir(path)
+	})
+
+	return listing.entries, listing.err
+}
+
+// Forget : Drop the listing of a directory, it will be read again if needed
+func (c *DirCache) Forget(path string) {
+	c.mu.Lock()
+	delete(c.listings, path)
+	c.mu.Unlock()
+}
+
+// Stats : Number of hits and misses of the cache
+func (c *DirCache) Stats() (uint64, uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// ----------------------------- Match memo -----------------------------
+
+// matchResult : A single memoized evaluation, computed at most once
+type matchResult struct {
+	once    sync.Once
+	matched bool
+}
+
+// MatchMemo : Concurrency-safe memo of (structure hash, root) -> result
+type MatchMemo struct {
+	mu sync.Mutex
+	// map[root][structure hash] = result
+	results map[string]map[uint64]*matchResult
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewMatchMemo : Create an empty match memo
+func NewMatchMemo() *MatchMemo {
+	return &MatchMemo{
+		results: make(map[string]map[uint64]*matchResult),
+	}
+}
+
+// Lookup : Return the memoized result for a structure and a root, calling compute only on the first request
+func (m *MatchMemo) Lookup(structure Structure, root string, compute func() bool) bool {
+	m.mu.Lock()
+	byStructure, ok := m.results[root]
+	if !ok {
+		byStructure = make(map[uint64]*matchResult)
+		m.results[root] = byStructure
+	}
+
+	result, ok := byStructure[structure.Hash]
+	if !ok {
+		result = &matchResult{}
+		byStructure[structure.Hash] = result
+	}
+	m.mu.Unlock()
+
+	if ok {
+		m.hits.Add(1)
+	} else {
+		m.misses.Add(1)
+	}
+
+	result.once.Do(func() {
+		result.matched = compute()
+	})
+
+	return result.matched
+}
+
+// Forget : Drop the results of a root, they will be computed again if needed
+func (m *MatchMemo) Forget(root string) {
+	m.mu.Lock()
+	delete(m.results, root)
+	m.mu.Unlock()
+}
+
+// Stats : Number of hits and misses of the memo
+func (m *MatchMemo) Stats() (uint64, uint64) {
+	return m.hits.Load(), m.misses.Load()
+}
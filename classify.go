@@ -0,0 +1,73 @@
+package inseki
+
+import (
+	"sort"
+)
+
+// rankCandidates : Sort the structures matching a same root, the best one first
+// Most specific first (number of required nodes), then highest priority, then ID
+func rankCandidates(candidates []Response) {
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].Structure, candidates[j].Structure
+
+		if a.Specificity() != b.Specificity() {
+			return a.Specificity() > b.Specificity()
+		}
+
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+
+		return a.ID < b.ID
+	})
+}
+
+// classify : Keep the best candidate of a root, the others are kept as alternatives
+func classify(candidates []Response) Response {
+	rankCandidates(candidates)
+
+	winner := candidates[0]
+	for _, loser := range candidates[1:] {
+		winner.Alternatives = append(winner.Alternatives, loser.Structure)
+	}
+
+	return winner
+}
+
+// removeIntricated : Remove the candidates of a root that are duplicates of, or contained in, another candidate
+func removeIntricated(candidates []Response) []Response {
+	rankCandidates(candidates)
+
+	results := make([]Response, 0, len(candidates))
+
+	for i, candidate := range candidates {
+		keep := true
+
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+
+			inOther := candidate.Structure.Contains(other.Structure)
+			otherIn := other.Structure.Contains(candidate.Structure)
+
+			// Strictly contained in another structure
+			if inOther && !otherIn {
+				keep = false
+				break
+			}
+
+			// Same structure, keep the best ranked one
+			if inOther && otherIn && j < i {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			results = append(results, candidate)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,88 @@
+package inseki
+
+import (
+	"reflect"
+	"testing"
+)
+
+// classifyNode : A folder with the files given, "?" before a name makes it optional
+func classifyNode(children ...string) Node {
+	root := Node{Name: "*", IsDirectory: true}
+	for _, child := range children {
+		optional := child[0] == '?'
+		if optional {
+			child = child[1:]
+		}
+		root.Children = append(root.Children, Node{Name: child, Optional: optional})
+	}
+	return root
+}
+
+func classifyCandidates() []Response {
+	return []Response{
+		{Root: "p", Structure: Structure{ID: "c.json", Root: classifyNode("*.c")}},
+		{Root: "p", Structure: Structure{ID: "main.json", Root: classifyNode("*.c", "main.c")}},
+		{Root: "p", Structure: Structure{ID: "any.json", Root: classifyNode("*.c"), Priority: 1}},
+		{Root: "p", Structure: Structure{ID: "make.json", Root: classifyNode("Makefile", "?*.c")}},
+	}
+}
+
+func structureIDsOf(responses []Response) []string {
+	ids := make([]string, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.Structure.ID)
+	}
+	return ids
+}
+
+func TestRankCandidates(t *testing.T) {
+	candidates := classifyCandidates()
+
+	// Most required nodes, then priority, then ID, whatever the order they came in
+	want := []string{"main.json", "any.json", "c.json", "make.json"}
+	for i := 0; i < len(candidates); i++ {
+		rotated := append(append([]Response(nil), candidates[i:]...), candidates[:i]...)
+		rankCandidates(rotated)
+
+		if got := structureIDsOf(rotated); !reflect.DeepEqual(got, want) {
+			t.Errorf("ranked %q, want %q", got, want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	winner := classify(classifyCandidates())
+
+	alternatives := make([]string, 0)
+	for _, structure := range winner.Alternatives {
+		alternatives = append(alternatives, structure.ID)
+	}
+
+	if winner.Structure.ID != "main.json" || !reflect.DeepEqual(alternatives, []string{"any.json", "c.json", "make.json"}) {
+		t.Errorf("kept %s with alternatives %v", winner.Structure.ID, alternatives)
+	}
+}
+
+func TestRemoveIntricated(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []Response
+		want       []string
+	}{
+		// main.json refines c.json and any.json, which are the same structure (the best ranked one stays)
+		{"contained and duplicates", classifyCandidates(), []string{"main.json", "make.json"}},
+		{"alone", classifyCandidates()[:1], []string{"c.json"}},
+		{"unrelated", []Response{
+			{Root: "p", Structure: Structure{ID: "go.json", Root: classifyNode("go.mod")}},
+			{Root: "p", Structure: Structure{ID: "npm.json", Root: classifyNode("package.json")}},
+		}, []string{"go.json", "npm.json"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := structureIDsOf(removeIntricated(test.candidates)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("kept %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -4,11 +4,118 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"runtime"
+	"time"
 )
 
 type Config struct {
-	InsekiPath    string `json:"insekiPath"`
-	StructurePath string `json:"structurePath"`
+	InsekiPath    string       `json:"insekiPath"`
+	StructurePath string       `json:"structurePath"`
+	Nested        NestedPolicy `json:"nested,omitempty"`       // all (default), outermost or innermost
+	Exclusive     bool         `json:"exclusive,omitempty"`    // Only keep the best structure of each root
+	ErrorPolicy   ErrorPolicy  `json:"errorPolicy,omitempty"`  // best-effort (default) or fail-fast
+	ProjectStats  bool         `json:"projectStats,omitempty"` // Compute the size and content of each project
+	Metadata      bool         `json:"metadata,omitempty"`     // Read the manifests of each project (see Structure.Extractors)
+	Git           bool         `json:"git,omitempty"`          // Read the status of the git work tree holding each project
+
+	Archives ArchiveOptions `json:"archives,omitempty"` // Explore .zip and .tar(.gz) archives like folders
+	Walk     WalkOptions    `json:"walk,omitempty"`     // How the scanned folder is explored
+	Match    MatchOptions   `json:"match,omitempty"`    // How the files found are checked against the structures
+	Memory   MemoryOptions  `json:"memory,omitempty"`   // Bounded memory for very large trees
+	Results  ResultOptions  `json:"results,omitempty"`  // Order and page of the projects returned by Scan
+
+	FS       FileSystem `json:"-"` // Filesystem that is scanned, the OS if nil
+	ConfigFS FileSystem `json:"-"` // Filesystem holding InsekiPath and StructurePath, the OS if nil
+
+	OnProgress       ProgressFunc  `json:"-"` // Receives progress events during the scan (LogProgress logs a summary)
+	ProgressInterval time.Duration `json:"-"` // Minimum time between two events, DefaultProgressInterval if 0
+}
+
+// WalkOptions : Options of ExploreFolder
+type WalkOptions struct {
+	GitIgnore bool `json:"gitIgnore,omitempty"` // Also prune what .gitignore and .git/info/exclude files ignore
+
+	Workers       int  `json:"workers,omitempty"`       // Folders read in parallel, a single one if 0 or 1
+	Deterministic bool `json:"deterministic,omitempty"` // With several workers, keep the lexical order of a single one
+
+	// Limits, 0 or false means no limit (see WalkStats for the counters)
+	MaxDepth      int   `json:"maxDepth,omitempty"`      // Folders below the scanned one (1 : only its direct content)
+	OneFileSystem bool  `json:"oneFileSystem,omitempty"` // Don't cross mount points (find -xdev)
+	SkipHidden    bool  `json:"skipHidden,omitempty"`    // Skip files and folders starting with a dot
+	MaxDirEntries int   `json:"maxDirEntries,omitempty"` // Skip the content of folders with more entries
+	MaxFileSize   int64 `json:"maxFileSize,omitempty"`   // Skip files bigger than this (bytes)
+}
+
+// MatchOptions : Worker pool checking the files found by the walk, while the walk goes on
+type MatchOptions struct {
+	Workers   int `json:"workers,omitempty"`   // Files checked in parallel, DefaultMatchWorkers if 0
+	QueueSize int `json:"queueSize,omitempty"` // Files waiting to be checked before the walk waits, DefaultMatchQueueSize if 0
+}
+
+// DefaultMatchQueueSize : Files found by the walk that can wait for a worker
+const DefaultMatchQueueSize = 1024
+
+// DefaultMatchWorkers : Files checked in parallel, the matching mostly waits for the disk
+var DefaultMatchWorkers = 4 * runtime.NumCPU()
+
+func (m MatchOptions) workers() int {
+	if m.Workers > 0 {
+		return m.Workers
+	}
+	return DefaultMatchWorkers
+}
+
+func (m MatchOptions) queueSize() int {
+	if m.QueueSize > 0 {
+		return m.QueueSize
+	}
+	return DefaultMatchQueueSize
+}
+
+// MemoryOptions : Keep the memory of the scan bounded, whatever the size of the tree
+type MemoryOptions struct {
+	// Forget the cached listings and matches of a folder as soon as it is complete,
+	// and keep at most SpillThreshold projects in memory until the end of the scan
+	// Then only the page of Config.Results is held : without a Limit, the result itself holds every project
+	// The projects of one tree (an outermost project and every project inside it) are still read back together,
+	// as they are linked and grouped as a whole : a single huge tree of nested projects isn't bounded
+	Bounded bool `json:"bounded,omitempty"`
+
+	SpillThreshold int    `json:"spillThreshold,omitempty"` // Projects kept in memory before the next ones go to disk, DefaultSpillThreshold if 0
+	SpillDir       string `json:"spillDir,omitempty"`       // Folder of the temporary file, os.TempDir() if empty
+}
+
+// DefaultSpillThreshold : Projects kept in memory by a bounded scan before the next ones go to disk
+const DefaultSpillThreshold = 10000
+
+func (m MemoryOptions) spillThreshold() int {
+	if m.SpillThreshold > 0 {
+		return m.SpillThreshold
+	}
+	return DefaultSpillThreshold
+}
+
+// fileSystem : Filesystem that is scanned
+// Opened archives are cached by the returned FileSystem, so it has to be shared by the whole scan
+func (c Config) fileSystem() FileSystem {
+	fsys := c.FS
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+
+	if c.Archives.Enabled {
+		fsys = WithArchives(fsys, c.Archives)
+	}
+
+	return fsys
+}
+
+// configFileSystem : Filesystem holding the structures and the .insekiignore
+func (c Config) configFileSystem() FileSystem {
+	if c.ConfigFS == nil {
+		return OSFileSystem
+	}
+	return c.ConfigFS
 }
 
 func ReadEmbedConfigFile(configJson string) (error, Config) {
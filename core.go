@@ -1,126 +1,524 @@
 package inseki
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sync"
 )
 
-func analyze(path string, associations []Association, stack *Stack, insekiIgnore []string) (error, []Response) {
-	// ----------------------------- Explore the folder -----------------------------
-	numberFilesAnalysed := 0
+// ScanResult : Everything a scan found
+type ScanResult struct {
+	Roots     []string   `json:"roots"`     // Scanned folders, once the overlapping ones are removed
+	Responses []Response `json:"responses"` // Responses of the projects of the page, in their order, by structure ID
+	Total     int        `json:"total"`     // Projects (roots) found, before the page is taken
 
-	err := ExploreFolder(path,
-		insekiIgnore,
-		FilterWithPatternMap(&associations, stack),
-		&numberFilesAnalysed)
-	if err != nil {
-		return err, nil
+	Projects    []Project    `json:"projects"`    // Projects of the page, sorted (by root path by default)
+	ByStructure ProjectIndex `json:"byStructure"` // Roots of the projects of the page, for each structure
+	Walk        WalkStats    `json:"walk"`
+	Errors      []ScanError  `json:"errors"` // Errors met during the import, the walk and the matching
+}
+
+func analyze(ctx context.Context, roots []string, config Config, associations []Association, stack *Stack, insekiIgnore []string, report *ErrorReport, tracker *progressTracker, emit func([]Response)) (error, ScanResult) {
+	var stats WalkStats
+
+	fsys := config.fileSystem()
+
+	// Shared by every worker, so a folder is only read once and a root only checked once
+	matcher := NewMatcher(fsys)
+	matcher.Errors = report
+	tracker.matcher = matcher
+
+	resolver := newResolver(config.Exclusive)
+
+	// Nothing inside a complete folder will be checked again, except when a parent folder is the root
+	if config.Memory.Bounded {
+		resolver.complete = matcher.Forget
 	}
 
-	log.Printf("Number of files analysed: %d\n", numberFilesAnalysed)
+	// The scanned folders (and their parents) are only complete once every folder is walked
+	for _, root := range roots {
+		resolver.hold(root)
+	}
 
-	ch := make(chan Response)
-	var wg sync.WaitGroup
+	// ----------------------------- Check the files -----------------------------
+
+	// The walk waits when the queue is full, so the targets never pile up
+	targets := make(chan Target, config.Match.queueSize())
 
-	for !stack.IsEmpty() {
-		value := stack.Pop()
+	var wg sync.WaitGroup
 
+	for i := 0; i < config.Match.workers(); i++ {
 		wg.Add(1)
-		go func(value Target, ch chan Response) {
+		go func() {
 			defer wg.Done()
 
-			// For each structure, check if the file is a match
-			for _, structure := range value.Association.Structures {
-				matched, root := structure.Matches(value.Filepath)
-				if matched {
-					ch <- Response{
-						Filepath:  value.Filepath,
-						Structure: structure,
-						Root:      root,
-					}
+			for value := range targets {
+				// Once the scan is cancelled (or failed), the queue is only emptied
+				if ctx.Err() == nil && report.Fatal() == nil {
+					match(ctx, matcher, value, report, tracker, resolver)
 				}
+
+				// The roots around this file may be complete now
+				emit(resolver.done(value))
 			}
-		}(value, ch)
+		}()
 	}
 
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
+	// ----------------------------- Explore the folders -----------------------------
 
-	return nil, processResult(ch)
-}
+	tracker.enter(PhaseWalk)
 
-func processResult(ch chan Response) []Response {
-	// map[root] = []Response
-	// Helps to delete duplicates and intricated structures
-	sorted := make(map[string][]Response)
-
-	for response := range ch {
-		// If the root is not in the map, create a new entry
-		if _, ok := sorted[response.Root]; !ok {
-			sorted[response.Root] = make([]Response, 0)
-		}
+	var walkErr error
 
-		isDuplicate := false
+	for _, root := range roots {
+		var rootStats WalkStats
 
-		// If it's a duplicate (same structure and root) or intricated structure, skip
-		for index, value := range sorted[response.Root] {
+		filter := FilterWithPatternMap(&associations, stack)
+		observe := func(path string, info os.FileInfo) error {
+			err := filter(path, info)
 
-			// If the structure is the same, skip
-			if value.Structure.Equal(response.Structure, true) {
-				isDuplicate = true
-				break
+			if info.IsDir() {
+				resolver.open(path)
 			}
 
-			// If the structure current structure is contained in the stored structure, skip
-			if value.Structure.Contains(response.Structure) {
-				isDuplicate = true
-				break
+			// Targets found by the filter go to the workers, remembering which root they come from
+			for !stack.IsEmpty() {
+				value := stack.Pop()
+				value.ScanRoot = root
+				resolver.add(value)
+
+				select {
+				case targets <- value:
+				case <-ctx.Done():
+					resolver.done(value)
+					return ctx.Err()
+				}
 			}
 
-			// If the stored structure is contained in the current structure, remove the stored structure
-			if response.Structure.Contains(value.Structure) {
-				sorted[response.Root] = append(sorted[response.Root][:index], sorted[response.Root][index+1:]...)
-			}
+			tracker.targets.Store(int64(len(targets)))
+			tracker.visit(path, info.IsDir())
+
+			return err
+		}
+
+		walkErr = exploreFolder(ctx, fsys, root,
+			insekiIgnore,
+			config.Walk,
+			observe,
+			func(dir string) { emit(resolver.leave(dir)) },
+			&rootStats,
+			report)
 
+		stats.Add(rootStats)
+
+		if walkErr != nil {
+			break
+		}
+	}
+
+	tracker.enter(PhaseMatch)
+
+	for _, root := range roots {
+		emit(resolver.release(root))
+	}
+
+	close(targets)
+	wg.Wait()
+
+	// Projects confirmed before the cancellation (or the error) are still sent
+	emit(resolver.flush())
+
+	result := ScanResult{Roots: roots, Walk: stats}
+
+	if walkErr != nil {
+		return walkErr, result
+	}
+
+	if err := report.Fatal(); err != nil {
+		return err, result
+	}
+
+	return ctx.Err(), result
+}
+
+// match : Check every structure associated to a target
+func match(ctx context.Context, matcher *Matcher, value Target, report *ErrorReport, tracker *progressTracker, resolver *resolver) {
+	for _, structure := range value.Association.Structures {
+		if ctx.Err() != nil || report.Fatal() != nil {
+			return
 		}
 
-		if isDuplicate {
-			continue
+		matched, root := matcher.MatchStructure(structure, value.Filepath)
+		tracker.candidates.Add(1)
+
+		if matched {
+			resolver.match(Response{
+				Filepath:  value.Filepath,
+				Structure: structure,
+				Root:      root,
+				ScanRoot:  value.ScanRoot,
+			})
 		}
+	}
+}
+
+// resolver : Deduplicate the responses of a root as soon as every target that can lead to it is checked
+// A root is always the folder of a target or one of its parents, so a folder is complete once
+// it is walked and every target inside it is checked
+type resolver struct {
+	exclusive bool
+
+	mu sync.Mutex
+	// map[folder] = targets and folders being walked inside it, that are not done yet
+	pending map[string]int
+	// Folders being walked
+	walking map[string]bool
+
+	// Called (if not nil) once a folder is complete
+	complete func(dir string)
+	// map[root][structure ID] = Response
+	// Helps to delete duplicates, whatever the order in which the responses arrive
+	sorted map[string]map[string]Response
+}
+
+func newResolver(exclusive bool) *resolver {
+	return &resolver{
+		exclusive: exclusive,
+		pending:   make(map[string]int),
+		walking:   make(map[string]bool),
+		sorted:    make(map[string]map[string]Response),
+	}
+}
+
+// parents : Call fn on the path and each of its parents, like GoUp does
+func parents(path string, fn func(dir string)) {
+	dir := filepath.Clean(path)
+	for {
+		fn(dir)
 
-		// Append the response to the root
-		sorted[response.Root] = append(sorted[response.Root], response)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
 	}
+}
+
+// hold : Something inside path is not done yet, its roots have to wait for it
+func (r *resolver) hold(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parents(path, func(dir string) {
+		r.pending[dir]++
+	})
+}
 
-	// ----------------------------- Return the results -----------------------------
+// release : Something inside path is done, returns the projects of the roots that are now complete
+func (r *resolver) release(path string) []Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	return r.releaseLocked(path)
+}
+
+func (r *resolver) releaseLocked(path string) []Response {
 	results := make([]Response, 0)
 
-	for _, value := range sorted {
-		for _, response := range value {
-			results = append(results, response)
+	parents(path, func(dir string) {
+		r.pending[dir]--
+		if r.pending[dir] > 0 {
+			return
+		}
+
+		delete(r.pending, dir)
+		results = append(results, r.settle(dir)...)
+
+		if r.complete != nil {
+			r.complete(dir)
 		}
+	})
+
+	return results
+}
+
+// add : A target will be checked
+func (r *resolver) add(target Target) {
+	r.hold(target.Filepath)
+}
+
+// done : A target is checked
+func (r *resolver) done(target Target) []Response {
+	return r.release(target.Filepath)
+}
+
+// match : A structure matched around a target
+func (r *resolver) match(response Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// If the root is not in the map, create a new entry
+	if _, ok := r.sorted[response.Root]; !ok {
+		r.sorted[response.Root] = make(map[string]Response)
+	}
+
+	// Same structure and root: keep the same trigger file on every run
+	stored, ok := r.sorted[response.Root][response.Structure.ID]
+	if !ok || response.Filepath < stored.Filepath {
+		r.sorted[response.Root][response.Structure.ID] = response
+	}
+}
+
+// open : The walk entered a folder
+func (r *resolver) open(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.walking[dir] {
+		return
+	}
+	r.walking[dir] = true
+
+	parents(dir, func(dir string) {
+		r.pending[dir]++
+	})
+}
+
+// leave : The walk is done with a folder (ignored if it was not opened)
+func (r *resolver) leave(dir string) []Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.walking[dir] {
+		return nil
+	}
+	delete(r.walking, dir)
+
+	return r.releaseLocked(dir)
+}
+
+// flush : Returns the projects of every root left (the scan stopped before checking all the targets)
+func (r *resolver) flush() []Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]Response, 0)
+	for root := range r.sorted {
+		results = append(results, r.settle(root)...)
 	}
 
 	return results
 }
 
+// settle : Keep the projects of a complete root
+func (r *resolver) settle(root string) []Response {
+	byStructure, ok := r.sorted[root]
+	if !ok {
+		return nil
+	}
+	delete(r.sorted, root)
+
+	candidates := make([]Response, 0, len(byStructure))
+	for _, response := range byStructure {
+		candidates = append(candidates, response)
+	}
+
+	if r.exclusive {
+		// One structure per root, the others are kept as alternatives
+		return []Response{classify(candidates)}
+	}
+
+	// Remove duplicates and intricated structures
+	return removeIntricated(candidates)
+}
+
 // Process : Run a complete disk analysis
 func Process(path string, config Config, insekiIgnore []string) (error, []Response) {
+	return ProcessContext(context.Background(), path, config, insekiIgnore)
+}
+
+// ProcessContext : Run a complete disk analysis, that stops when ctx is done
+// In that case, the projects found so far are returned along with ctx.Err()
+func ProcessContext(ctx context.Context, path string, config Config, insekiIgnore []string) (error, []Response) {
+	err, result := Scan(ctx, path, config, insekiIgnore)
+	return err, result.Responses
+}
+
+// Scan : Run a complete disk analysis, and report the statistics and errors along with the projects
+// With the best-effort policy (default), errors are only listed in the result
+func Scan(ctx context.Context, path string, config Config, insekiIgnore []string) (error, ScanResult) {
+	return ScanRoots(ctx, []string{path}, config, insekiIgnore)
+}
+
+// ScanRoots : Same as Scan, for several folders sharing the same structures
+// A folder inside another one (or symlinked to it) is only scanned once, each project records its ScanRoot
+func ScanRoots(ctx context.Context, paths []string, config Config, insekiIgnore []string) (error, ScanResult) {
+	var mu sync.Mutex
+	store := newSpillStore(config.Memory)
+	defer store.close()
+
+	collect := func(settled []Response) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := store.add(settled); err != nil {
+			log.Printf("Projects kept in memory, they can't be written to disk: %v\n", err)
+			store.keep()
+		}
+	}
+
+	return scanRoots(ctx, paths, config, insekiIgnore, collect, func(result *ScanResult, matcher *Matcher) {
+		fsys := config.fileSystem()
+
+		// Errors of the statistics are only reported when they were asked, the walk already reported the rest
+		report := NewErrorReport(BestEffort)
+		statsReport := report
+		if !config.ProjectStats {
+			statsReport = NewErrorReport(BestEffort)
+		}
+
+		// Sizes and times are read in one walk per tree, with the ignore rules of the scan (the statistics are kept if asked)
+		sortByStats := config.Results.SortBy == SortBySize || config.Results.SortBy == SortByModTime
+
+		// The sort key was checked before the scan
+		less := projectLess(config.Results.SortBy, config.Results.Descending, func(p Project) *ProjectStats { return p.Stats })
+		window := newProjectWindow(config.Results, less)
+
+		// Projects come root after root, each one followed by the projects inside it :
+		// the projects of a tree are linked and grouped together, then only the page is kept
+		tree := make([]Response, 0)
+		flush := func() {
+			if len(tree) == 0 {
+				return
+			}
+
+			// Parents and nested projects are only known once every project of the tree is found
+			// Each project is sorted and paged as a whole, whatever its number of structures
+			// The files satisfying each structure are only collected for the page
+			projects := groupProjects(linkProjects(tree, config.Nested))
+
+			if sortByStats {
+				readProjectsStats(ctx, fsys, projects, insekiIgnore, config.Walk, config.ProjectStats, config.Match.workers(), statsReport)
+			}
+
+			for _, project := range projects {
+				window.add(project)
+			}
+			tree = tree[:0]
+		}
+
+		err := store.each(func(response Response) {
+			if len(tree) > 0 && !isWithin(tree[0].Root, response.Root) {
+				flush()
+			}
+			tree = append(tree, response)
+		})
+		flush()
+
+		if err != nil {
+			result.Errors = append(result.Errors, ScanError{Path: config.Memory.SpillDir, Phase: PhaseMatch, Err: err})
+		}
+
+		result.Total = window.total
+		result.Projects = window.page(config.Results.Offset)
+		result.ByStructure = IndexProjects(result.Projects)
+
+		// The listings read by the scan are reused, its errors were already reported
+		pageMatcher := NewMatcher(fsys)
+		if matcher != nil {
+			pageMatcher = &Matcher{Dirs: matcher.Dirs, Memo: matcher.Memo}
+		}
+		collectMatches(pageMatcher, result.Projects)
+
+		if sortByStats && !config.ProjectStats {
+			for i := range result.Projects {
+				result.Projects[i].Stats = nil
+			}
+		}
+
+		result.Responses = make([]Response, 0)
+		for _, project := range result.Projects {
+			result.Responses = append(result.Responses, project.Responses()...)
+		}
+
+		// ----------------------------- Describe the projects -----------------------------
+
+		if !config.ProjectStats && !config.Metadata && !config.Git {
+			return
+		}
+
+		statuses := newGitCache()
+
+		if config.ProjectStats && !sortByStats {
+			readProjectsStats(ctx, fsys, result.Projects, insekiIgnore, config.Walk, true, config.Match.workers(), report)
+		}
+
+		forEachProject(ctx, result.Projects, config.Match.workers(), func(project *Project) {
+			if config.Metadata {
+				err, metadata := ExtractMetadata(fsys, project.Root, projectExtractors(*project))
+				if err != nil {
+					report.Add(project.Root, PhaseMetadata, err)
+				}
+				project.Metadata = &metadata
+			}
+
+			if config.Git {
+				err, status := statuses.read(ctx, fsys, project.Root)
+				if err == nil {
+					project.Git = &status
+				} else if !errors.Is(err, ErrNotGitRepository) {
+					report.Add(project.Root, PhaseMetadata, err)
+				}
+			}
+		})
+
+		result.Errors = append(result.Errors, report.Errors()...)
+	})
+}
+
+// scanRoots : Import the structures and scan the folders, each project is given to emit once its root is complete
+// done can complete the result before the last progress event, with the matcher of the scan (nil if the walk didn't start)
+func scanRoots(ctx context.Context, paths []string, config Config, insekiIgnore []string, emit func([]Response), done func(result *ScanResult, matcher *Matcher)) (error, ScanResult) {
+
+	if !config.Nested.IsValid() {
+		return fmt.Errorf("unknown nested policy: %s", config.Nested), ScanResult{}
+	}
+
+	if !config.ErrorPolicy.IsValid() {
+		return fmt.Errorf("unknown error policy: %s", config.ErrorPolicy), ScanResult{}
+	}
+
+	if !config.Results.SortBy.IsValid() {
+		return fmt.Errorf("unknown sort key: %s", config.Results.SortBy), ScanResult{}
+	}
+
+	report := NewErrorReport(config.ErrorPolicy)
+	tracker := newProgressTracker(config.OnProgress, config.ProgressInterval, report)
 
 	// ----------------------------- Read the structures -----------------------------
 	numberStructuresAnalysed := 0
 
-	err, structures := ImportStructure(config, insekiIgnore, &numberStructuresAnalysed)
-	if err != nil {
-		return err, nil
+	tracker.enter(PhaseImport)
+
+	err, structures := ImportStructure(ctx, config, insekiIgnore, &numberStructuresAnalysed, report)
+
+	tracker.structures.Store(int64(numberStructuresAnalysed))
+
+	if err == nil && len(structures) == 0 {
+		err = fmt.Errorf("no structure found")
 	}
 
-	if len(structures) == 0 {
-		return fmt.Errorf("no structure found"), nil
+	if err != nil {
+		result := ScanResult{Errors: report.Errors()}
+		if done != nil {
+			done(&result, nil)
+		}
+		tracker.finish(result)
+		return err, result
 	}
 
 	patterns := ExtractNames(structures, false)
@@ -128,13 +526,31 @@ func Process(path string, config Config, insekiIgnore []string) (error, []Respon
 
 	stack := &Stack{}
 
-	log.Printf("Number of structures analysed: %d\n", numberStructuresAnalysed)
-
 	// ----------------------------- Analyze the folder -----------------------------
 
-	err, val := analyze(path, associations, stack, insekiIgnore)
+	err, roots := normalizeRoots(config.FS, paths, report)
+	if err != nil {
+		result := ScanResult{Errors: report.Errors()}
+		if done != nil {
+			done(&result, nil)
+		}
+		tracker.finish(result)
+		return err, result
+	}
+
+	err, result := analyze(ctx, roots, config, associations, stack, insekiIgnore, report, tracker, func(settled []Response) {
+		tracker.confirm(len(settled))
+		emit(settled)
+	})
 
 	// ----------------------------- Process the results -----------------------------
 
-	return nil, val
+	result.Errors = report.Errors()
+	if done != nil {
+		done(&result, tracker.matcher)
+	}
+
+	tracker.finish(result)
+
+	return err, result
 }
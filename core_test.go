@@ -0,0 +1,397 @@
+package inseki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// scanTestConfig : Structures "c.json" (a folder with .c files) and "go.json" (a folder with a go.mod), and the tree scanned
+func scanTestConfig(t *testing.T) Config {
+	t.Helper()
+
+	return Config{
+		InsekiPath:    "inseki",
+		StructurePath: "structures",
+		ConfigFS: FromFS(fstest.MapFS{
+			"inseki/.insekiignore": {Data: []byte("ignored/\n")},
+			"structures/c.json":    {Data: []byte(`{"name": "*", "isDirectory": true, "children": [{"name": "*.c", "isDirectory": false}]}`)},
+			"structures/go.json":   {Data: []byte(`{"name": "*", "isDirectory": true, "children": [{"name": "go.mod", "isDirectory": false}]}`)},
+		}),
+		FS: FromFS(scanTestFiles()),
+	}
+}
+
+// scanTestFiles : The tree scanned, two C projects nested in others
+func scanTestFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"data/a/main.c":        {Data: []byte("int main() {}\n")},
+		"data/a/sub/util.c":    {Data: []byte("void util() {}\n")},
+		"data/a-b/other.c":     {Data: []byte("x\n")},
+		"data/b/go.mod":        {Data: []byte("module b\n")},
+		"data/b/cgo/wrap.c":    {Data: []byte("wrap\n")},
+		"data/ignored/skip.c":  {Data: []byte("skip\n")},
+		"data/big/large.c":     {Data: bytes.Repeat([]byte("line\n"), 100)},
+		"data/notes/readme.md": {Data: []byte("notes\n")},
+	}
+}
+
+func scanTest(t *testing.T, config Config) ScanResult {
+	t.Helper()
+
+	err, ignore := ReadInsekiIgnore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, result := ScanRoots(context.Background(), []string{"data"}, config, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("errors: %v", result.Errors)
+	}
+
+	return result
+}
+
+func projectRoots(projects []Project) []string {
+	roots := make([]string, 0, len(projects))
+	for _, project := range projects {
+		roots = append(roots, project.Root)
+	}
+	return roots
+}
+
+func responseKeys(responses []Response) []string {
+	keys := make([]string, 0, len(responses))
+	for _, response := range responses {
+		keys = append(keys, response.Root+" "+response.Structure.ID+" "+response.Filepath)
+	}
+	return keys
+}
+
+func TestScanRoots(t *testing.T) {
+	want := []string{
+		"data/a c.json data/a/main.c",
+		"data/a-b c.json data/a-b/other.c",
+		"data/a/sub c.json data/a/sub/util.c",
+		"data/b go.json data/b/go.mod",
+		"data/b/cgo c.json data/b/cgo/wrap.c",
+		"data/big c.json data/big/large.c",
+	}
+
+	tests := []struct {
+		name   string
+		change func(config *Config)
+	}{
+		{"defaults", func(config *Config) {}},
+		{"one walker", func(config *Config) { config.Walk.Workers = 1 }},
+		{"walkers, deterministic", func(config *Config) {
+			config.Walk.Workers = 4
+			config.Walk.Deterministic = true
+		}},
+		{"walkers, unordered", func(config *Config) { config.Walk.Workers = 4 }},
+		{"one matcher", func(config *Config) { config.Match.Workers = 1 }},
+		{"matchers, short queue", func(config *Config) {
+			config.Walk.Workers = 4
+			config.Match = MatchOptions{Workers: 8, QueueSize: 1}
+		}},
+		{"bounded, every project spilled", func(config *Config) {
+			config.Memory = MemoryOptions{Bounded: true, SpillThreshold: 1, SpillDir: t.TempDir()}
+		}},
+		{"bounded, unordered", func(config *Config) {
+			config.Walk.Workers = 4
+			config.Memory = MemoryOptions{Bounded: true, SpillThreshold: 2, SpillDir: t.TempDir()}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for run := 0; run < 10; run++ {
+				config := scanTestConfig(t)
+				test.change(&config)
+
+				result := scanTest(t, config)
+				if got := responseKeys(result.Responses); !reflect.DeepEqual(got, want) {
+					t.Fatalf("responses %q, want %q", got, want)
+				}
+				if result.Total != len(want) || len(result.Projects) != len(want) {
+					t.Fatalf("%d projects of %d, want %d", len(result.Projects), result.Total, len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestScanRootsOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	for name, file := range scanTestFiles() {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := scanTestConfig(t)
+	want := responseKeys(scanTest(t, config).Responses)
+
+	// The same tree on the disk gives the same projects
+	config.FS = nil
+	err, ignore := ReadInsekiIgnore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, result := ScanRoots(context.Background(), []string{filepath.Join(dir, "data")}, config, ignore)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatal(err, result.Errors)
+	}
+
+	got := make([]string, 0, len(result.Responses))
+	for _, key := range responseKeys(result.Responses) {
+		got = append(got, strings.ReplaceAll(filepath.ToSlash(key), filepath.ToSlash(dir)+"/", ""))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responses on the disk %q, want %q", got, want)
+	}
+}
+
+func TestScanRootsArchives(t *testing.T) {
+	files := scanTestFiles()
+	files["data/arch.zip"] = &fstest.MapFile{Data: zipArchive(t, map[string]string{"proj/inner.c": "inner\n", "proj/go.mod": "module inner\n"})}
+
+	config := scanTestConfig(t)
+	config.FS = FromFS(files)
+	config.Archives.Enabled = true
+
+	result := scanTest(t, config)
+
+	want := []string{"data/arch.zip!/proj c.json data/arch.zip!/proj/inner.c", "data/arch.zip!/proj go.json data/arch.zip!/proj/go.mod"}
+	got := make([]string, 0)
+	for _, key := range responseKeys(result.Responses) {
+		if strings.HasPrefix(key, "data/arch.zip") {
+			got = append(got, key)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responses in the archive %q, want %q", got, want)
+	}
+
+	// Without the option, the archive is a file
+	config.Archives.Enabled = false
+	result = scanTest(t, config)
+	for _, project := range result.Projects {
+		if strings.HasPrefix(project.Root, "data/arch.zip") {
+			t.Errorf("project %s found without Archives.Enabled", project.Root)
+		}
+	}
+}
+
+func TestScanRootsGitIgnore(t *testing.T) {
+	tests := []struct {
+		name      string
+		gitIgnore bool
+		want      []string
+	}{
+		{"git ignore files skipped", false, []string{"data/p", "data/p/build", "data/p/local", "data/p/vendor"}},
+		{"git ignore files read", true, []string{"data/p", "data/p/vendor"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := scanTestConfig(t)
+			config.FS = FromFS(fstest.MapFS{
+				"data/p/main.c":            {Data: []byte("main\n")},
+				"data/p/.gitignore":        {Data: []byte("build/\nvendor/\n")},
+				"data/p/.insekiignore":     {Data: []byte("!vendor/\n")},
+				"data/p/.git/info/exclude": {Data: []byte("local/\n")},
+				"data/p/build/gen.c":       {Data: []byte("gen\n")},
+				"data/p/local/scratch.c":   {Data: []byte("scratch\n")},
+				"data/p/vendor/lib.c":      {Data: []byte("lib\n")},
+			})
+			config.Walk.GitIgnore = test.gitIgnore
+
+			result := scanTest(t, config)
+			if got := projectRoots(result.Projects); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("projects %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// cancelFileSystem : Cancels the scan when a folder is read, once a project was confirmed
+type cancelFileSystem struct {
+	FileSystem
+	at        string
+	confirmed chan struct{}
+	cancel    context.CancelFunc
+}
+
+func (f cancelFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	if name == f.at {
+		select {
+		case <-f.confirmed:
+		case <-time.After(10 * time.Second):
+		}
+		f.cancel()
+	}
+
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestProcessContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	confirmed := make(chan struct{})
+	var once sync.Once
+
+	config := scanTestConfig(t)
+	config.FS = cancelFileSystem{
+		FileSystem: FromFS(fstest.MapFS{
+			"data/a/main.c": {Data: []byte("main\n")},
+			"data/z/late.c": {Data: []byte("late\n")},
+		}),
+		at:        "data/z",
+		confirmed: confirmed,
+		cancel:    cancel,
+	}
+	config.Walk.Workers = 1
+	config.ProgressInterval = time.Nanosecond
+	config.OnProgress = func(progress Progress) {
+		if progress.ProjectsFound > 0 {
+			once.Do(func() { close(confirmed) })
+		}
+	}
+
+	err, ignore := ReadInsekiIgnore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelled in the middle of the walk, once data/a is confirmed
+	err, responses := ProcessContext(ctx, "data", config, ignore)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+	if got := responseKeys(responses); !reflect.DeepEqual(got, []string{"data/a c.json data/a/main.c"}) {
+		t.Errorf("responses %q along with the cancellation", got)
+	}
+
+	// Cancelled before the scan starts
+	err, responses = ProcessContext(ctx, "data", scanTestConfig(t), ignore)
+	if !errors.Is(err, context.Canceled) || len(responses) != 0 {
+		t.Errorf("already cancelled : %v, %d responses", err, len(responses))
+	}
+
+	// A deadline stops the scan the same way
+	deadline, stop := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer stop()
+
+	if err, _ := ProcessContext(deadline, "data", scanTestConfig(t), ignore); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline : %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	response := func(root string, id string, file string) Response {
+		return Response{Root: root, Filepath: file, Structure: Structure{ID: id, Root: Node{Name: "*", IsDirectory: true, Children: []Node{{Name: id}}}}}
+	}
+	target := func(file string) Target { return Target{Filepath: file} }
+
+	r := newResolver(false)
+	r.open("s")
+	r.add(target("s/a/x.c"))
+	r.add(target("s/a/y.c"))
+	r.add(target("s/b/z.c"))
+
+	r.match(response("s/a", "c.json", "s/a/y.c"))
+	r.match(response("s", "parent.json", "s/a/x.c"))
+
+	// A root waits for every target inside it
+	if got := r.done(target("s/a/y.c")); len(got) != 0 {
+		t.Fatalf("s/a settled before s/a/x.c is checked: %v", got)
+	}
+
+	// The first trigger file is kept, whatever the order
+	r.match(response("s/a", "c.json", "s/a/x.c"))
+	got := r.done(target("s/a/x.c"))
+	if keys := responseKeys(got); !reflect.DeepEqual(keys, []string{"s/a c.json s/a/x.c"}) {
+		t.Fatalf("settled %q once s/a is done", keys)
+	}
+
+	// The scanned folder also waits for its walk
+	if got := r.done(target("s/b/z.c")); len(got) != 0 {
+		t.Fatalf("s settled before its walk is done: %v", got)
+	}
+	if keys := responseKeys(r.leave("s")); !reflect.DeepEqual(keys, []string{"s parent.json s/a/x.c"}) {
+		t.Fatalf("settled %q once s is left", keys)
+	}
+	if got := r.leave("s"); got != nil {
+		t.Errorf("left twice: %v", got)
+	}
+
+	// Roots left when the scan stops
+	r.match(response("t", "c.json", "t/x.c"))
+	if keys := responseKeys(r.flush()); !reflect.DeepEqual(keys, []string{"t c.json t/x.c"}) {
+		t.Errorf("flushed %q", keys)
+	}
+	if got := r.flush(); len(got) != 0 {
+		t.Errorf("flushed twice: %v", got)
+	}
+}
+
+func TestScanRootsResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		nested  NestedPolicy
+		results ResultOptions
+		bounded bool
+		want    []string
+		total   int
+	}{
+		{"by path", "", ResultOptions{}, false, []string{"data/a", "data/a-b", "data/a/sub", "data/b", "data/b/cgo", "data/big"}, 6},
+		{"page", "", ResultOptions{Offset: 1, Limit: 2}, false, []string{"data/a-b", "data/a/sub"}, 6},
+		{"page, bounded", "", ResultOptions{Offset: 1, Limit: 2}, true, []string{"data/a-b", "data/a/sub"}, 6},
+		{"page after the end", "", ResultOptions{Offset: 10, Limit: 2}, false, []string{}, 6},
+		{"by size, descending", "", ResultOptions{SortBy: SortBySize, Descending: true, Limit: 2}, false, []string{"data/big", "data/a"}, 6},
+		{"by size, bounded", "", ResultOptions{SortBy: SortBySize, Descending: true, Limit: 2}, true, []string{"data/big", "data/a"}, 6},
+		{"by structure", "", ResultOptions{SortBy: SortByStructure, Descending: true, Limit: 1}, false, []string{"data/b"}, 6},
+		{"by depth", "", ResultOptions{SortBy: SortByDepth, Descending: true, Limit: 2}, false, []string{"data/a/sub", "data/b/cgo"}, 6},
+		{"outermost", NestedOutermost, ResultOptions{}, false, []string{"data/a", "data/a-b", "data/b", "data/big"}, 4},
+		{"innermost", NestedInnermost, ResultOptions{}, false, []string{"data/a-b", "data/a/sub", "data/b/cgo", "data/big"}, 4},
+		{"innermost, bounded page", NestedInnermost, ResultOptions{Offset: 1, Limit: 2}, true, []string{"data/a/sub", "data/b/cgo"}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := scanTestConfig(t)
+			config.Nested = test.nested
+			config.Results = test.results
+			if test.bounded {
+				config.Memory = MemoryOptions{Bounded: true, SpillThreshold: 1, SpillDir: t.TempDir()}
+			}
+
+			result := scanTest(t, config)
+			if got := projectRoots(result.Projects); !reflect.DeepEqual(got, test.want) || result.Total != test.total {
+				t.Errorf("projects %q of %d, want %q of %d", got, result.Total, test.want, test.total)
+			}
+			for _, project := range result.Projects {
+				if project.Stats != nil {
+					t.Errorf("statistics computed to sort %s are returned", project.Root)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package inseki
+
+import (
+	"io/fs"
+)
+
+// deviceID : Device holding a file, never known on this platform (OneFileSystem has no effect)
+func deviceID(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package inseki
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// deviceID : Device holding a file, false if it can't be known (virtual filesystems)
+func deviceID(info fs.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
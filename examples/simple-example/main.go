@@ -22,6 +22,9 @@ func main() {
 		panic(err)
 	}
 
+	// Log a summary of the scan once it is done
+	config.OnProgress = inseki.LogProgress
+
 	err, insekiIgnore := inseki.ReadInsekiIgnore(config)
 	if err != nil {
 		panic(err)
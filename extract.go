@@ -0,0 +1,398 @@
+package inseki
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metadata : What the manifests of a project say about it
+type Metadata struct {
+	Name         string       `json:"name,omitempty"`
+	Version      string       `json:"version,omitempty"`
+	Description  string       `json:"description,omitempty"`
+	Title        string       `json:"title,omitempty"` // First title of the README
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	Targets      []string     `json:"targets,omitempty"` // Targets of the Makefile
+
+	Sources []string `json:"sources"` // Extractors that found their manifest
+}
+
+// Dependency : A dependency declared by a manifest
+type Dependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"` // Version or constraint as written, "" if there is none
+}
+
+/*
+Extractor : Fill the metadata of a project from one kind of manifest found at its root
+found is false when the manifest is not there, fields already filled by a previous extractor are kept
+*/
+type Extractor func(fsys FileSystem, root string, metadata *Metadata) (error, bool)
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]Extractor{
+		"go":     extractGoMod,
+		"npm":    extractPackageJSON,
+		"cargo":  extractCargoToml,
+		"python": extractPyProject,
+		"cmake":  extractCMakeLists,
+		"make":   extractMakefile,
+		"readme": extractReadme,
+	}
+)
+
+// DefaultExtractors : Extractors applied to the projects whose structures don't declare any, in this order
+var DefaultExtractors = []string{"go", "npm", "cargo", "python", "cmake", "make", "readme"}
+
+// RegisterExtractor : Add (or replace) an extractor, structures can then declare it by name
+func RegisterExtractor(name string, extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	extractors[name] = extractor
+}
+
+// ExtractMetadata : Apply extractors to a root, in order (DefaultExtractors if none are given)
+// Errors of an extractor are returned after the others are applied
+func ExtractMetadata(fsys FileSystem, root string, names []string) (error, Metadata) {
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+	if len(names) == 0 {
+		names = DefaultExtractors
+	}
+
+	var metadata Metadata
+	var errs []error
+
+	for _, name := range names {
+		extractorsMu.RLock()
+		extractor, ok := extractors[name]
+		extractorsMu.RUnlock()
+
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown extractor: %s", name))
+			continue
+		}
+
+		err, found := extractor(fsys, root, &metadata)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		if found {
+			metadata.Sources = append(metadata.Sources, name)
+		}
+	}
+
+	return errors.Join(errs...), metadata
+}
+
+// projectExtractors : Extractors declared by the structures of a project, in order and without duplicates
+func projectExtractors(project Project) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, structure := range project.Structures {
+		for _, name := range structure.Structure.Extractors {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// ----------------------------- Helpers -----------------------------
+
+// readManifest : Read a file of the root, found is false if it doesn't exist
+func readManifest(fsys FileSystem, root string, name string) (error, []byte, bool) {
+	data, err := fsys.ReadFile(filepath.Join(root, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, false
+	}
+	if err != nil {
+		return err, nil, false
+	}
+	return nil, data, true
+}
+
+// setIfEmpty : Keep what a previous extractor found
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// sortedDependencies : Dependencies of a name -> version map, sorted by name
+func sortedDependencies(versions map[string]string) []Dependency {
+	dependencies := make([]Dependency, 0, len(versions))
+	for name, version := range versions {
+		dependencies = append(dependencies, Dependency{Name: name, Version: version})
+	}
+
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Name < dependencies[j].Name
+	})
+
+	return dependencies
+}
+
+// ----------------------------- go.mod -----------------------------
+
+func extractGoMod(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	err, data, found := readManifest(fsys, root, "go.mod")
+	if !found {
+		return err, false
+	}
+
+	inRequire := false
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// Comments (// indirect) are not part of the dependency
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 0:
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) >= 2:
+			metadata.Dependencies = append(metadata.Dependencies, Dependency{Name: fields[0], Version: fields[1]})
+		case fields[0] == "module" && len(fields) >= 2:
+			setIfEmpty(&metadata.Name, strings.Trim(fields[1], `"`))
+		case fields[0] == "require" && len(fields) >= 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) >= 3:
+			metadata.Dependencies = append(metadata.Dependencies, Dependency{Name: fields[1], Version: fields[2]})
+		}
+	}
+
+	return nil, true
+}
+
+// ----------------------------- package.json -----------------------------
+
+func extractPackageJSON(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	err, data, found := readManifest(fsys, root, "package.json")
+	if !found {
+		return err, false
+	}
+
+	var manifest struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Description     string            `json:"description"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err, true
+	}
+
+	setIfEmpty(&metadata.Name, manifest.Name)
+	setIfEmpty(&metadata.Version, manifest.Version)
+	setIfEmpty(&metadata.Description, manifest.Description)
+
+	metadata.Dependencies = append(metadata.Dependencies, sortedDependencies(manifest.Dependencies)...)
+	metadata.Dependencies = append(metadata.Dependencies, sortedDependencies(manifest.DevDependencies)...)
+
+	return nil, true
+}
+
+// ----------------------------- Cargo.toml -----------------------------
+
+func extractCargoToml(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	err, data, found := readManifest(fsys, root, "Cargo.toml")
+	if !found {
+		return err, false
+	}
+
+	tables := readTOML(data)
+
+	setIfEmpty(&metadata.Name, tomlString(tables["package"]["name"]))
+	setIfEmpty(&metadata.Version, tomlString(tables["package"]["version"]))
+	setIfEmpty(&metadata.Description, tomlString(tables["package"]["description"]))
+
+	metadata.Dependencies = append(metadata.Dependencies, tomlDependencies(tables, "dependencies")...)
+
+	return nil, true
+}
+
+// ----------------------------- pyproject.toml -----------------------------
+
+// pep508Name : Name at the beginning of a requirement ("requests>=2.0" -> requests, >=2.0)
+var pep508Name = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+
+func extractPyProject(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	err, data, found := readManifest(fsys, root, "pyproject.toml")
+	if !found {
+		return err, false
+	}
+
+	tables := readTOML(data)
+
+	// PEP 621, then Poetry
+	for _, name := range []string{"project", "tool.poetry"} {
+		setIfEmpty(&metadata.Name, tomlString(tables[name]["name"]))
+		setIfEmpty(&metadata.Version, tomlString(tables[name]["version"]))
+		setIfEmpty(&metadata.Description, tomlString(tables[name]["description"]))
+	}
+
+	for _, requirement := range tomlStrings(tables["project"]["dependencies"]) {
+		if match := pep508Name.FindStringSubmatch(requirement); match != nil {
+			metadata.Dependencies = append(metadata.Dependencies, Dependency{Name: match[1], Version: strings.TrimSpace(match[3])})
+		}
+	}
+
+	for _, dependency := range tomlDependencies(tables, "tool.poetry.dependencies") {
+		// Poetry lists the Python version with the dependencies
+		if dependency.Name != "python" {
+			metadata.Dependencies = append(metadata.Dependencies, dependency)
+		}
+	}
+
+	return nil, true
+}
+
+// ----------------------------- CMakeLists.txt -----------------------------
+
+var (
+	cmakeProject     = regexp.MustCompile(`(?is)\bproject\s*\(([^)]*)\)`)
+	cmakeArgument    = regexp.MustCompile(`"[^"]*"|[^\s"]+`)
+	cmakeFindPackage = regexp.MustCompile(`(?i)\bfind_package\s*\(\s*([A-Za-z0-9_.+-]+)(?:\s+([0-9][0-9.]*))?`)
+)
+
+func extractCMakeLists(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	err, data, found := readManifest(fsys, root, "CMakeLists.txt")
+	if !found {
+		return err, false
+	}
+
+	// project(<name> [VERSION <version>] [DESCRIPTION <description>] [LANGUAGES ...])
+	if match := cmakeProject.FindSubmatch(data); match != nil {
+		arguments := cmakeArgument.FindAllString(string(match[1]), -1)
+
+		for i, argument := range arguments {
+			argument = strings.Trim(argument, `"`)
+
+			switch {
+			case i == 0:
+				setIfEmpty(&metadata.Name, argument)
+			case i+1 < len(arguments) && strings.EqualFold(argument, "VERSION"):
+				setIfEmpty(&metadata.Version, strings.Trim(arguments[i+1], `"`))
+			case i+1 < len(arguments) && strings.EqualFold(argument, "DESCRIPTION"):
+				setIfEmpty(&metadata.Description, strings.Trim(arguments[i+1], `"`))
+			}
+		}
+	}
+
+	for _, match := range cmakeFindPackage.FindAllSubmatch(data, -1) {
+		metadata.Dependencies = append(metadata.Dependencies, Dependency{Name: string(match[1]), Version: string(match[2])})
+	}
+
+	return nil, true
+}
+
+// ----------------------------- Makefile -----------------------------
+
+// makeTarget : "target: prerequisites", not a variable (:=, ::=) nor a special target (.PHONY)
+var makeTarget = regexp.MustCompile(`^([A-Za-z0-9_][A-Za-z0-9_./%-]*(?:\s+[A-Za-z0-9_][A-Za-z0-9_./%-]*)*)\s*::?(?:$|[^:=])`)
+
+func extractMakefile(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	var data []byte
+	var err error
+	found := false
+
+	for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+		if err, data, found = readManifest(fsys, root, name); found || err != nil {
+			break
+		}
+	}
+	if !found {
+		return err, false
+	}
+
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		match := makeTarget.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		for _, target := range strings.Fields(match[1]) {
+			// Pattern rules are not targets that can be called
+			if !seen[target] && !strings.Contains(target, "%") {
+				seen[target] = true
+				metadata.Targets = append(metadata.Targets, target)
+			}
+		}
+	}
+
+	return nil, true
+}
+
+// ----------------------------- README -----------------------------
+
+func extractReadme(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		return err, false
+	}
+
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		if entry.IsDir() || !strings.HasPrefix(name, "readme") {
+			continue
+		}
+
+		err, data, found := readManifest(fsys, root, entry.Name())
+		if !found {
+			return err, false
+		}
+
+		setIfEmpty(&metadata.Title, readmeTitle(string(data)))
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// readmeTitle : First title of a Markdown (# Title, or underlined) or reStructuredText file
+func readmeTitle(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "#") {
+			title := strings.TrimSpace(strings.Trim(line, "#"))
+			if title != "" {
+				return title
+			}
+			continue
+		}
+
+		// Title underlined with = or - (Markdown and reStructuredText)
+		if line != "" && i+1 < len(lines) {
+			next := strings.TrimSpace(lines[i+1])
+			if len(next) >= 3 && (strings.Trim(next, "=") == "" || strings.Trim(next, "-") == "") {
+				return line
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,144 @@
+package inseki
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func extractTestFS() FileSystem {
+	return FromFS(fstest.MapFS{
+		"gomod/go.mod": {Data: []byte(`module github.com/me/tool
+
+go 1.22
+
+require github.com/single/dep v1.0.0
+
+require (
+	github.com/a/b v1.2.3
+	golang.org/x/sys v0.1.0 // indirect
+	// github.com/commented/out v0.0.1
+)
+
+replace github.com/a/b => ../b
+`)},
+		"npm/package.json": {Data: []byte(`{
+	"name": "app",
+	"version": "1.0.0",
+	"description": "An app",
+	"dependencies": {"react": "^18.0.0", "axios": "1.6.0"},
+	"devDependencies": {"vitest": "^1.0.0"}
+}`)},
+		"broken/package.json": {Data: []byte(`{"name": `)},
+		"cmake/CMakeLists.txt": {Data: []byte(`cmake_minimum_required(VERSION 3.20)
+project(Engine
+    VERSION 2.1
+    DESCRIPTION "A game engine"
+    LANGUAGES CXX)
+find_package(SDL2 2.0 REQUIRED)
+find_package(Threads)
+`)},
+		"make/Makefile": {Data: []byte(`CC := gcc
+CC ::= gcc
+CC::=gcc
+x :::= y
+LD:=ld
+.PHONY: all clean
+all: build
+build test: main.o
+%.o: %.c
+clean:
+	rm -f *.o
+`)},
+		"readme/README.md":  {Data: []byte("\n# My Project\n\nText\n")},
+		"underline/readme":  {Data: []byte("Title\n=====\n")},
+		"both/go.mod":       {Data: []byte("module both\n")},
+		"both/package.json": {Data: []byte(`{"name": "other", "version": "3.0"}`)},
+		"both/README.md":    {Data: []byte("# Both\n")},
+		"empty/.keep":       {},
+	})
+}
+
+func TestExtractMetadata(t *testing.T) {
+	tests := []struct {
+		root  string
+		names []string
+		want  Metadata
+	}{
+		{"gomod", []string{"go"}, Metadata{
+			Name: "github.com/me/tool",
+			Dependencies: []Dependency{
+				{Name: "github.com/single/dep", Version: "v1.0.0"}, {Name: "github.com/a/b", Version: "v1.2.3"}, {Name: "golang.org/x/sys", Version: "v0.1.0"},
+			},
+			Sources: []string{"go"},
+		}},
+		{"npm", []string{"npm"}, Metadata{
+			Name: "app", Version: "1.0.0", Description: "An app",
+			Dependencies: []Dependency{{Name: "axios", Version: "1.6.0"}, {Name: "react", Version: "^18.0.0"}, {Name: "vitest", Version: "^1.0.0"}},
+			Sources:      []string{"npm"},
+		}},
+		{"cmake", []string{"cmake"}, Metadata{
+			Name: "Engine", Version: "2.1", Description: "A game engine",
+			Dependencies: []Dependency{{Name: "SDL2", Version: "2.0"}, {Name: "Threads"}},
+			Sources:      []string{"cmake"},
+		}},
+		{"make", []string{"make"}, Metadata{Targets: []string{"all", "build", "test", "clean"}, Sources: []string{"make"}}},
+		{"readme", []string{"readme"}, Metadata{Title: "My Project", Sources: []string{"readme"}}},
+		{"underline", []string{"readme"}, Metadata{Title: "Title", Sources: []string{"readme"}}},
+		// The first extractor that finds a field keeps it
+		{"both", nil, Metadata{Name: "both", Version: "3.0", Title: "Both", Sources: []string{"go", "npm", "readme"}}},
+		{"empty", nil, Metadata{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.root, func(t *testing.T) {
+			err, metadata := ExtractMetadata(extractTestFS(), test.root, test.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(metadata, test.want) {
+				t.Errorf("got %+v, want %+v", metadata, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		names   []string
+		sources []string
+	}{
+		{"unknown extractor", "npm", []string{"nothing", "npm"}, []string{"npm"}},
+		{"unreadable manifest", "broken", []string{"npm"}, []string{"npm"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, metadata := ExtractMetadata(extractTestFS(), test.root, test.names)
+			if err == nil {
+				t.Error("no error")
+			}
+			if !reflect.DeepEqual(metadata.Sources, test.sources) {
+				t.Errorf("sources %v, want %v", metadata.Sources, test.sources)
+			}
+		})
+	}
+}
+
+func TestRegisterExtractor(t *testing.T) {
+	RegisterExtractor("test-license", func(fsys FileSystem, root string, metadata *Metadata) (error, bool) {
+		err, data, found := readManifest(fsys, root, "LICENSE")
+		if found {
+			setIfEmpty(&metadata.Description, string(data))
+		}
+		return err, found
+	})
+
+	fsys := FromFS(fstest.MapFS{"p/LICENSE": {Data: []byte("MIT")}})
+	err, metadata := ExtractMetadata(fsys, "p", []string{"test-license"})
+	if err != nil || metadata.Description != "MIT" {
+		t.Errorf("got %+v, %v", metadata, err)
+	}
+}
@@ -0,0 +1,128 @@
+package inseki
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// projectFields : Value of each field for a project, nil when it wasn't computed (no stats, no metadata, no git status)
+var projectFields = map[string]func(p Project) interface{}{
+	"root":         func(p Project) interface{} { return p.Root },
+	"scanRoot":     func(p Project) interface{} { return p.ScanRoot },
+	"parent":       func(p Project) interface{} { return p.Parent },
+	"nested":       func(p Project) interface{} { return nonNil(p.Nested) },
+	"structures":   func(p Project) interface{} { return p.Labels() },
+	"triggers":     func(p Project) interface{} { return p.Triggers() },
+	"alternatives": func(p Project) interface{} { return structureIDs(p.Alternatives) },
+
+	"size":   statsField(func(s *ProjectStats) interface{} { return s.Size }),
+	"files":  statsField(func(s *ProjectStats) interface{} { return s.Files }),
+	"dirs":   statsField(func(s *ProjectStats) interface{} { return s.Dirs }),
+	"lines":  statsField(func(s *ProjectStats) interface{} { return s.Lines }),
+	"newest": statsField(func(s *ProjectStats) interface{} { return s.Newest }),
+	"oldest": statsField(func(s *ProjectStats) interface{} { return s.Oldest }),
+
+	"name":         metadataField(func(m *Metadata) interface{} { return m.Name }),
+	"version":      metadataField(func(m *Metadata) interface{} { return m.Version }),
+	"description":  metadataField(func(m *Metadata) interface{} { return m.Description }),
+	"dependencies": metadataField(func(m *Metadata) interface{} { return dependencyNames(m.Dependencies) }),
+
+	"branch":     gitField(func(g *GitStatus) interface{} { return g.Branch }),
+	"head":       gitField(func(g *GitStatus) interface{} { return g.Head }),
+	"upstream":   gitField(func(g *GitStatus) interface{} { return g.Upstream }),
+	"ahead":      gitField(func(g *GitStatus) interface{} { return g.Ahead }),
+	"behind":     gitField(func(g *GitStatus) interface{} { return g.Behind }),
+	"dirty":      gitField(func(g *GitStatus) interface{} { return g.Dirty }),
+	"modified":   gitField(func(g *GitStatus) interface{} { return g.Modified }),
+	"staged":     gitField(func(g *GitStatus) interface{} { return g.Staged }),
+	"conflicted": gitField(func(g *GitStatus) interface{} { return g.Conflicted }),
+	"untracked":  gitField(func(g *GitStatus) interface{} { return g.Untracked }),
+	"stashes":    gitField(func(g *GitStatus) interface{} { return g.Stashes }),
+	"localWork":  gitField(func(g *GitStatus) interface{} { return g.HasLocalWork() }),
+}
+
+// ProjectFields : Every field of a project known by name (formatters, templates), in a sensible column order
+var ProjectFields = []string{
+	"root", "scanRoot", "parent", "nested", "structures", "triggers", "alternatives",
+	"size", "files", "dirs", "lines", "newest", "oldest",
+	"name", "version", "description", "dependencies",
+	"branch", "head", "upstream", "ahead", "behind", "dirty", "modified", "staged", "conflicted", "untracked", "stashes", "localWork",
+}
+
+// ProjectField : Value of a field for a project, nil when the scan didn't compute it
+// Lists are []string, times are time.Time, the rest are strings, numbers and booleans
+func ProjectField(name string, project Project) (error, interface{}) {
+	fn, ok := projectFields[name]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", name), nil
+	}
+	return nil, fn(project)
+}
+
+// FieldText : Value of a field as text, lists joined with sep, times in RFC 3339, nothing for what wasn't computed
+func FieldText(value interface{}, sep string) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(value, sep)
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+func statsField(fn func(s *ProjectStats) interface{}) func(p Project) interface{} {
+	return func(p Project) interface{} {
+		if p.Stats == nil {
+			return nil
+		}
+		return fn(p.Stats)
+	}
+}
+
+func metadataField(fn func(m *Metadata) interface{}) func(p Project) interface{} {
+	return func(p Project) interface{} {
+		if p.Metadata == nil {
+			return nil
+		}
+		return fn(p.Metadata)
+	}
+}
+
+func gitField(fn func(g *GitStatus) interface{}) func(p Project) interface{} {
+	return func(p Project) interface{} {
+		if p.Git == nil {
+			return nil
+		}
+		return fn(p.Git)
+	}
+}
+
+// nonNil : Lists are written as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func structureIDs(structures []Structure) []string {
+	ids := make([]string, 0, len(structures))
+	for _, structure := range structures {
+		ids = append(ids, structure.ID)
+	}
+	return ids
+}
+
+func dependencyNames(dependencies []Dependency) []string {
+	names := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		names = append(names, dependency.Name)
+	}
+	return names
+}
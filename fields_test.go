@@ -0,0 +1,79 @@
+package inseki
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectFields(t *testing.T) {
+	if len(ProjectFields) != len(projectFields) {
+		t.Errorf("%d fields listed, %d known", len(ProjectFields), len(projectFields))
+	}
+	for _, field := range ProjectFields {
+		if err, _ := ProjectField(field, Project{}); err != nil {
+			t.Errorf("%s listed but unknown", field)
+		}
+	}
+	if err, _ := ProjectField("colour", Project{}); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestProjectField(t *testing.T) {
+	project := Project{
+		Root:       "/data/app",
+		Structures: []ProjectStructure{{Structure: Structure{ID: "go.json"}, Trigger: "/data/app/go.mod"}},
+		Stats:      &ProjectStats{Size: 1536},
+		Git:        &GitStatus{Ahead: 1, Stashes: 1},
+	}
+
+	tests := []struct {
+		field string
+		text  string
+	}{
+		{"root", "/data/app"},
+		{"structures", "go.json"},
+		{"nested", ""},
+		{"size", "1536"},
+		{"newest", ""},
+		{"name", ""},
+		{"dependencies", ""},
+		{"ahead", "1"},
+		{"localWork", "true"},
+	}
+
+	for _, test := range tests {
+		err, value := ProjectField(test.field, project)
+		if err != nil || FieldText(value, ", ") != test.text {
+			t.Errorf("%s = %v (%q), %v, want %q", test.field, value, FieldText(value, ", "), err, test.text)
+		}
+	}
+
+	// Fields that weren't computed are nil, not a zero value
+	if _, value := ProjectField("name", project); value != nil {
+		t.Errorf("name without metadata = %#v", value)
+	}
+}
+
+func TestFieldText(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"text", "text"},
+		{42, "42"},
+		{int64(-1), "-1"},
+		{false, "false"},
+		{[]string{"a", "b"}, "a;b"},
+		{[]string{}, ""},
+		{time.Time{}, ""},
+		{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "2024-05-01T12:00:00Z"},
+	}
+
+	for _, test := range tests {
+		if got := FieldText(test.value, ";"); got != test.want {
+			t.Errorf("FieldText(%#v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package inseki
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystem : Filesystem read by the scan (walk, import and matching), the OS by default
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// ----------------------------- OS -----------------------------
+
+type osFileSystem struct{}
+
+// OSFileSystem : The real filesystem, paths are native paths
+var OSFileSystem FileSystem = osFileSystem{}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFileSystem) open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) readDirLimit(name string, n int) ([]fs.DirEntry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readDirFile(file, n)
+}
+
+// onOS : Check if a FileSystem reads the real disk, where ~ and symbolic links make sense
+func onOS(fsys FileSystem) bool {
+	switch f := fsys.(type) {
+	case nil, osFileSystem:
+		return true
+	case *archiveFileSystem:
+		return onOS(f.base)
+	case limitedFileSystem:
+		return onOS(f.FileSystem)
+	}
+	return false
+}
+
+// statRoot : Stat the folder a walk starts from, following it if it is a symbolic link on the OS
+// Below the root, symbolic links are not followed
+func statRoot(fsys FileSystem, root string) (fs.FileInfo, error) {
+	info, err := fsys.Stat(root)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 && onOS(fsys) {
+		return os.Stat(root)
+	}
+	return info, err
+}
+
+// ----------------------------- io/fs -----------------------------
+
+// ioFileSystem : Adapter from an fs.FS (fstest.MapFS, embed.FS, ...)
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+// FromFS : Use an fs.FS as a FileSystem
+// Paths given to the scan are relative to the root of fsys ("/" and "." both mean the root)
+func FromFS(fsys fs.FS) FileSystem {
+	return ioFileSystem{fsys: fsys}
+}
+
+// name : Translate a scan path to a valid fs.FS path
+func (i ioFileSystem) name(name string) string {
+	name = strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (i ioFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(i.fsys, i.name(name))
+}
+
+func (i ioFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(i.fsys, i.name(name))
+}
+
+func (i ioFileSystem) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(i.fsys, i.name(name))
+}
+
+func (i ioFileSystem) open(name string) (io.ReadCloser, error) {
+	return i.fsys.Open(i.name(name))
+}
+
+func (i ioFileSystem) readDirLimit(name string, n int) ([]fs.DirEntry, error) {
+	file, err := i.fsys.Open(i.name(name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dir, ok := file.(fs.ReadDirFile)
+	if !ok {
+		return fs.ReadDir(i.fsys, i.name(name))
+	}
+	return readDirFile(dir, n)
+}
+
+// ----------------------------- Streams -----------------------------
+
+// fileOpener : A FileSystem able to read a file as a stream
+type fileOpener interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+// openFile : Open a file to read it as a stream, from its whole content when fsys can't stream it
+func openFile(fsys FileSystem, name string) (io.ReadCloser, error) {
+	if opener, ok := fsys.(fileOpener); ok {
+		return opener.open(name)
+	}
+
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ----------------------------- Limited listings -----------------------------
+
+// dirLimiter : A FileSystem able to stop listing a folder after some entries
+type dirLimiter interface {
+	readDirLimit(name string, n int) ([]fs.DirEntry, error)
+}
+
+// readDirLimit : At most n entries of a folder (sorted by name, like ReadDir), without listing the rest when possible
+// The entries kept are the first ones the filesystem gives, so only their number is meaningful when there are more than n
+func readDirLimit(fsys FileSystem, name string, n int) ([]fs.DirEntry, error) {
+	if limiter, ok := fsys.(dirLimiter); ok {
+		return limiter.readDirLimit(name, n)
+	}
+	return fsys.ReadDir(name)
+}
+
+// readDirFile : Read at most n entries of an opened folder
+func readDirFile(dir fs.ReadDirFile, n int) ([]fs.DirEntry, error) {
+	entries := make([]fs.DirEntry, 0)
+
+	for len(entries) < n {
+		batch, err := dir.ReadDir(n - len(entries))
+		entries = append(entries, batch...)
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
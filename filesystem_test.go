@@ -0,0 +1,123 @@
+package inseki
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFromFSNames(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"a/b/file.txt": {Data: []byte("content")},
+	})
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"a/b/file.txt", true},
+		{"/a/b/file.txt", true},
+		{"./a/./b/../b/file.txt", true},
+		{filepath.Join("a", "b", "file.txt"), true},
+		{"a/b/missing.txt", false},
+	}
+
+	for _, test := range tests {
+		data, err := fsys.ReadFile(test.name)
+		if (err == nil) != test.ok || (test.ok && string(data) != "content") {
+			t.Errorf("ReadFile(%s) = %q, %v", test.name, data, err)
+		}
+	}
+
+	for _, root := range []string{"", ".", "/"} {
+		entries, err := fsys.ReadDir(root)
+		if err != nil || len(entries) != 1 || entries[0].Name() != "a" {
+			t.Errorf("ReadDir(%q) = %v, %v", root, entries, err)
+		}
+	}
+}
+
+func TestReadDirLimit(t *testing.T) {
+	files := fstest.MapFS{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		files["dir/"+name] = &fstest.MapFile{}
+	}
+
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{1, 1},
+		{3, 3},
+		{5, 5},
+		{10, 5},
+	}
+
+	for _, test := range tests {
+		entries, err := readDirLimit(FromFS(files), "dir", test.n)
+		if err != nil || len(entries) != test.want {
+			t.Errorf("readDirLimit(%d) = %d entries, %v, want %d", test.n, len(entries), err, test.want)
+		}
+	}
+}
+
+// readFileOnly : A FileSystem that can't stream its files
+type readFileOnly struct{ FileSystem }
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("on disk"), 0644)
+
+	tests := []struct {
+		name string
+		fsys FileSystem
+		path string
+		want string
+	}{
+		{"os", OSFileSystem, filepath.Join(dir, "file.txt"), "on disk"},
+		{"fs.FS", FromFS(fstest.MapFS{"file.txt": {Data: []byte("in memory")}}), "file.txt", "in memory"},
+		{"ReadFile only", readFileOnly{FromFS(fstest.MapFS{"file.txt": {Data: []byte("read whole")}})}, "file.txt", "read whole"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := openFile(test.fsys, test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			if data, err := io.ReadAll(reader); err != nil || string(data) != test.want {
+				t.Errorf("read %q, %v, want %q", data, err, test.want)
+			}
+		})
+	}
+
+	if _, err := openFile(readFileOnly{FromFS(fstest.MapFS{})}, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestOnOS(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys FileSystem
+		want bool
+	}{
+		{"nil", nil, true},
+		{"os", OSFileSystem, true},
+		{"archives on the os", WithArchives(OSFileSystem, ArchiveOptions{}), true},
+		{"fs.FS", FromFS(fstest.MapFS{}), false},
+		{"archives on an fs.FS", WithArchives(FromFS(fstest.MapFS{}), ArchiveOptions{}), false},
+	}
+
+	for _, test := range tests {
+		if got := onOS(test.fsys); got != test.want {
+			t.Errorf("%s : onOS = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
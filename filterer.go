@@ -14,12 +14,19 @@ type Association struct {
 type Target struct {
 	Filepath    string
 	Association Association
+	ScanRoot    string // Scanned folder the file was found in
 }
 
 type Response struct {
-	Filepath  string
-	Root      string
-	Structure Structure
+	Filepath  string    `json:"filepath"`
+	Root      string    `json:"root"`
+	ScanRoot  string    `json:"scanRoot"` // Scanned folder the project was found in
+	Structure Structure `json:"structure"`
+	Parent    string    `json:"parent,omitempty"` // Root of the closest enclosing project, "" if there is none
+	Nested    []string  `json:"nested,omitempty"` // Roots of the projects directly nested in this one
+
+	// Other structures matching the same root, ranked, when only the best one is kept (Config.Exclusive)
+	Alternatives []Structure `json:"alternatives,omitempty"`
 }
 
 func (r Response) String() string {
@@ -59,16 +66,11 @@ func FilterWithPatternMap(patterns *[]Association, stack *Stack) func(path strin
 			if match, _ := filepath.Match(association.Pattern, filepath.Base(path)); match {
 
 				// Add the path to the stack
+				// Directories are still explored, as they could contain nested projects
 				stack.Push(Target{
 					Filepath:    path,
 					Association: association,
 				})
-
-				// If it's a directory, we don't need to go deeper
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-
 			}
 		}
 
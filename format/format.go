@@ -0,0 +1,180 @@
+// Package format writes the projects of an inseki scan as JSON, NDJSON, CSV, Markdown or aligned tables
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	inseki "github.com/ForkBench/Inseki-Core"
+)
+
+// Format : How Write writes the projects of a scan
+type Format string
+
+const (
+	JSON     Format = "json"     // One document : schema version, total, projects and errors
+	NDJSON   Format = "ndjson"   // One project per line, each with the schema version
+	CSV      Format = "csv"      // A header, then one record per project
+	Markdown Format = "markdown" // A Markdown table
+	Table    Format = "table"    // Columns aligned for a terminal
+)
+
+// Schema : Version written in the JSON document and in each NDJSON line ("schema"), raised when a field changes meaning or disappears
+const Schema = 1
+
+// DefaultFields : Fields written when none are chosen (inseki.ProjectFields lists them all)
+var DefaultFields = []string{"root", "structures", "triggers"}
+
+// IsValid : Check if the format is known (an empty format means Table)
+func (f Format) IsValid() bool {
+	switch f {
+	case "", JSON, NDJSON, CSV, Markdown, Table:
+		return true
+	}
+	return false
+}
+
+// outputDocument : What JSON writes
+type outputDocument struct {
+	Schema   int                      `json:"schema"`
+	Total    int                      `json:"total"` // Projects found, the page may hold fewer of them
+	Fields   []string                 `json:"fields"`
+	Projects []map[string]interface{} `json:"projects"`
+	Errors   []inseki.ScanError       `json:"errors"`
+}
+
+/*
+Write : Write the projects of a scan in the given format, with the chosen fields (DefaultFields if none)
+Fields of the statistics, the metadata and the git status are empty unless the scan computed them
+*/
+func Write(w io.Writer, format Format, result inseki.ScanResult, fields []string) error {
+	if !format.IsValid() {
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	for _, field := range fields {
+		if err, _ := inseki.ProjectField(field, inseki.Project{}); err != nil {
+			return fmt.Errorf("unknown output field: %s", field)
+		}
+	}
+
+	// values : The chosen fields of a project, in order
+	values := func(project inseki.Project) []interface{} {
+		row := make([]interface{}, len(fields))
+		for i, field := range fields {
+			_, row[i] = inseki.ProjectField(field, project)
+		}
+		return row
+	}
+
+	switch format {
+	case JSON:
+		document := outputDocument{
+			Schema:   Schema,
+			Total:    result.Total,
+			Fields:   fields,
+			Projects: make([]map[string]interface{}, 0, len(result.Projects)),
+			Errors:   result.Errors,
+		}
+		if document.Errors == nil {
+			document.Errors = []inseki.ScanError{}
+		}
+		for _, project := range result.Projects {
+			document.Projects = append(document.Projects, fieldMap(fields, values(project)))
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		for _, project := range result.Projects {
+			line := fieldMap(fields, values(project))
+			line["schema"] = Schema
+
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(fields)
+		for _, project := range result.Projects {
+			writer.Write(textRow(values(project), ";"))
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case Markdown:
+		separators := make([]string, len(fields))
+		for i := range separators {
+			separators[i] = "---"
+		}
+
+		lines := []string{markdownRow(fields), markdownRow(separators)}
+		for _, project := range result.Projects {
+			lines = append(lines, markdownRow(textRow(values(project), ", ")))
+		}
+
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		return err
+	}
+
+	// Table
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	headers := make([]string, len(fields))
+	for i, field := range fields {
+		headers[i] = strings.ToUpper(field)
+	}
+	fmt.Fprintln(writer, strings.Join(headers, "\t"))
+
+	for _, project := range result.Projects {
+		row := textRow(values(project), ", ")
+		for i := range row {
+			// A tab or a line break would break the columns
+			row[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(row[i])
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+
+	return writer.Flush()
+}
+
+func fieldMap(fields []string, values []interface{}) map[string]interface{} {
+	object := make(map[string]interface{}, len(fields))
+	for i, field := range fields {
+		object[field] = values[i]
+	}
+	return object
+}
+
+// textRow : Values as text, lists joined with sep (see inseki.FieldText)
+func textRow(values []interface{}, sep string) []string {
+	row := make([]string, len(values))
+	for i, value := range values {
+		row[i] = inseki.FieldText(value, sep)
+	}
+	return row
+}
+
+func markdownRow(cells []string) string {
+	escaper := strings.NewReplacer("|", `\|`, "\r", "", "\n", " ")
+
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = escaper.Replace(cell)
+	}
+
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
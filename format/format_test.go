@@ -0,0 +1,147 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	inseki "github.com/ForkBench/Inseki-Core"
+)
+
+// formatTestResult : Two projects, only the first one with statistics, metadata and a git status
+func formatTestResult() inseki.ScanResult {
+	newest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	return inseki.ScanResult{
+		Roots: []string{"/data"},
+		Total: 3,
+		Projects: []inseki.Project{
+			{
+				Root:     "/data/app",
+				ScanRoot: "/data",
+				Nested:   []string{"/data/app/lib"},
+				Structures: []inseki.ProjectStructure{
+					{Structure: inseki.Structure{ID: "go.json", Name: "Go"}, Trigger: "/data/app/go.mod"},
+					{Structure: inseki.Structure{ID: "c.json", Name: "C"}, Trigger: "/data/app/main.c"},
+				},
+				Stats:    &inseki.ProjectStats{Size: 1536, Files: 2, Newest: newest},
+				Metadata: &inseki.Metadata{Name: "app", Description: "Pipes | and\nlines", Dependencies: []inseki.Dependency{{Name: "a"}, {Name: "b"}}},
+				Git:      &inseki.GitStatus{Branch: "main", Ahead: 1, Dirty: true},
+			},
+			{
+				Root:       "/data/app/lib",
+				ScanRoot:   "/data",
+				Parent:     "/data/app",
+				Structures: []inseki.ProjectStructure{{Structure: inseki.Structure{ID: "c.json", Name: "C"}, Trigger: "/data/app/lib/x.c"}},
+			},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	fields := []string{"root", "structures", "size", "newest", "description", "dependencies", "branch", "localWork"}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{CSV, `root,structures,size,newest,description,dependencies,branch,localWork
+/data/app,go.json;c.json,1536,2024-05-01T12:00:00Z,"Pipes | and
+lines",a;b,main,true
+/data/app/lib,c.json,,,,,,
+`},
+		{Markdown, `| root | structures | size | newest | description | dependencies | branch | localWork |
+| --- | --- | --- | --- | --- | --- | --- | --- |
+| /data/app | go.json, c.json | 1536 | 2024-05-01T12:00:00Z | Pipes \| and lines | a, b | main | true |
+| /data/app/lib | c.json |  |  |  |  |  |  |
+`},
+		{Table, `ROOT           STRUCTURES       SIZE  NEWEST                DESCRIPTION        DEPENDENCIES  BRANCH  LOCALWORK
+/data/app      go.json, c.json  1536  2024-05-01T12:00:00Z  Pipes | and lines  a, b          main    true
+/data/app/lib  c.json                                                                                
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var output bytes.Buffer
+			if err := Write(&output, test.format, formatTestResult(), fields); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", output.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var output bytes.Buffer
+	if err := Write(&output, JSON, formatTestResult(), []string{"root", "size", "nested"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		Schema   int                      `json:"schema"`
+		Total    int                      `json:"total"`
+		Fields   []string                 `json:"fields"`
+		Projects []map[string]interface{} `json:"projects"`
+		Errors   []interface{}            `json:"errors"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if document.Schema != Schema || document.Total != 3 || len(document.Projects) != 2 || document.Errors == nil {
+		t.Errorf("document %+v", document)
+	}
+	if document.Projects[0]["size"] != 1536.0 || document.Projects[1]["size"] != nil {
+		t.Errorf("sizes %v and %v, want 1536 and null", document.Projects[0]["size"], document.Projects[1]["size"])
+	}
+	if nested, ok := document.Projects[1]["nested"].([]interface{}); !ok || len(nested) != 0 {
+		t.Errorf("nested %v, want an empty list", document.Projects[1]["nested"])
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var output bytes.Buffer
+	if err := Write(&output, NDJSON, formatTestResult(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines", len(lines))
+	}
+
+	for _, line := range lines {
+		var project map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &project); err != nil {
+			t.Fatal(err)
+		}
+
+		// Default fields, and the schema on each line
+		if project["schema"] != float64(Schema) || len(project) != len(DefaultFields)+1 {
+			t.Errorf("line %s", line)
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		fields []string
+	}{
+		{"unknown format", "xml", nil},
+		{"unknown field", JSON, []string{"root", "colour"}},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		if err := Write(&output, test.format, formatTestResult(), test.fields); err == nil || output.Len() > 0 {
+			t.Errorf("%s : error %v, wrote %q", test.name, err, output.String())
+		}
+	}
+}
@@ -0,0 +1,997 @@
+package inseki
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GitStatus : State of the git work tree holding a project, read from its .git folder (no git binary, no network)
+type GitStatus struct {
+	WorkTree string            `json:"workTree"`           // Folder holding .git, the project root or one of its parents
+	Branch   string            `json:"branch,omitempty"`   // Current branch, "" when HEAD is detached
+	Head     string            `json:"head,omitempty"`     // Commit checked out, "" in a repository without commits
+	Remotes  map[string]string `json:"remotes"`            // map[remote name] = URL
+	Upstream string            `json:"upstream,omitempty"` // Branch tracked by the current one, like "origin/main", "" if there is none
+
+	// Commits of HEAD missing from the upstream branch, and the other way around, from the local refs (nothing is fetched)
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+
+	Branches []GitBranch `json:"branches"` // Every local branch, by name
+	Stashes  int         `json:"stashes"`  // Entries of the stash
+
+	// Files of the project folder only (the whole work tree when the project is at its root)
+	Dirty      bool `json:"dirty"`      // Tracked files modified, deleted, staged or in conflict
+	Modified   int  `json:"modified"`   // Tracked files changed or deleted in the work tree
+	Staged     int  `json:"staged"`     // Files whose staged version differs from HEAD
+	Conflicted int  `json:"conflicted"` // Files left unmerged by a merge, a rebase, ...
+	Untracked  int  `json:"untracked"`  // Files neither tracked nor ignored
+}
+
+// GitBranch : A local branch and how far it is from the branch it tracks
+type GitBranch struct {
+	Name     string `json:"name"`
+	Head     string `json:"head"`
+	Upstream string `json:"upstream,omitempty"` // "" if the branch tracks nothing
+
+	// With an upstream : commits missing from it, and the other way around
+	// Without one : commits missing from every remote branch, so they were never pushed anywhere
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+
+	Gone bool `json:"gone,omitempty"` // The upstream is set but its branch doesn't exist (deleted, never fetched)
+}
+
+// HasLocalWork : Check if something only exists in this clone : changes, untracked files, stashes,
+// or commits of a branch that its upstream (or every remote, for a branch without one) doesn't have
+func (s GitStatus) HasLocalWork() bool {
+	if s.Dirty || s.Untracked > 0 || s.Stashes > 0 {
+		return true
+	}
+
+	for _, branch := range s.Branches {
+		if branch.Ahead > 0 || branch.Gone {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNotGitRepository : The folder is not inside a git work tree
+var ErrNotGitRepository = errors.New("not a git repository")
+
+// gitCache : State of each repository, read once for all the projects of its work tree
+type gitCache struct {
+	mu     sync.Mutex
+	states map[string]*gitCached
+}
+
+type gitCached struct {
+	once  sync.Once
+	err   error
+	state gitState
+}
+
+func newGitCache() *gitCache {
+	return &gitCache{states: make(map[string]*gitCached)}
+}
+
+// read : ReadGitStatus, the state of the repository being shared by the projects of the same work tree
+func (c *gitCache) read(ctx context.Context, fsys FileSystem, root string) (error, GitStatus) {
+	err, repository := openGitRepository(fsys, root)
+	if err != nil {
+		return err, GitStatus{}
+	}
+
+	c.mu.Lock()
+	cached, ok := c.states[repository.workTree]
+	if !ok {
+		cached = &gitCached{}
+		c.states[repository.workTree] = cached
+	}
+	c.mu.Unlock()
+
+	cached.once.Do(func() {
+		cached.err, cached.state = repository.readState(ctx)
+		repository.close()
+	})
+
+	return repository.status(ctx, cached.err, cached.state, root)
+}
+
+// gitRepository : Files of a repository, read through a FileSystem
+type gitRepository struct {
+	fsys      FileSystem
+	workTree  string
+	gitDir    string // .git, or the folder it points to (worktrees, submodules)
+	commonDir string // Shared by the worktrees : objects, refs and config
+
+	packsLoaded bool
+	packs       []*gitPack
+}
+
+// gitState : What the repository says, whatever the project : refs, index and changes staged
+type gitState struct {
+	status   GitStatus    // Without the counts of files
+	index    gitIndex     // Files staged
+	staged   []string     // Paths whose staged version differs from HEAD
+	excludes []IgnoreRule // Rules of core.excludesFile
+}
+
+/*
+ReadGitStatus : Read the status of the work tree holding root (root itself or one of its parents)
+Branches, upstreams and stashes are the ones of the repository, files are only counted under root
+*/
+func ReadGitStatus(ctx context.Context, fsys FileSystem, root string) (error, GitStatus) {
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+
+	err, repository := openGitRepository(fsys, root)
+	if err != nil {
+		return err, GitStatus{}
+	}
+
+	err, state := repository.readState(ctx)
+	repository.close()
+
+	return repository.status(ctx, err, state, root)
+}
+
+// status : Status of the project at root, from the state of its repository
+func (r *gitRepository) status(ctx context.Context, err error, state gitState, root string) (error, GitStatus) {
+	status := state.status
+
+	// Each project gets its own copies, changing one doesn't change the others
+	status.Remotes = make(map[string]string, len(state.status.Remotes))
+	for name, url := range state.status.Remotes {
+		status.Remotes[name] = url
+	}
+	status.Branches = append([]GitBranch(nil), state.status.Branches...)
+
+	if err != nil {
+		return err, status
+	}
+
+	if err := r.countFiles(ctx, state, filepath.Clean(root), &status); err != nil {
+		return err, status
+	}
+
+	status.Dirty = status.Modified > 0 || status.Staged > 0 || status.Conflicted > 0
+
+	return nil, status
+}
+
+// readState : Read the refs, the index and what is staged
+func (r *gitRepository) readState(ctx context.Context) (error, gitState) {
+	state := gitState{
+		status: GitStatus{
+			WorkTree: r.workTree,
+			Remotes:  make(map[string]string),
+			Branches: make([]GitBranch, 0),
+		},
+	}
+	status := &state.status
+
+	config := r.readConfig()
+	for section, values := range config {
+		if name, ok := strings.CutPrefix(section, "remote."); ok && values["url"] != "" {
+			status.Remotes[name] = values["url"]
+		}
+	}
+
+	state.excludes = r.readExcludesFile(config)
+
+	// ----------------------------- HEAD and branches -----------------------------
+
+	head, err := r.readFile("HEAD")
+	if err != nil {
+		return err, state
+	}
+
+	ref := strings.TrimSpace(string(head))
+	if target, ok := strings.CutPrefix(ref, "ref: "); ok {
+		status.Branch = strings.TrimPrefix(target, "refs/heads/")
+		status.Head = r.resolveRef(target)
+	} else {
+		status.Head = ref
+	}
+
+	if err := r.readBranches(ctx, config, status); err != nil {
+		return err, state
+	}
+
+	for _, branch := range status.Branches {
+		if branch.Name == status.Branch && branch.Upstream != "" {
+			status.Upstream = branch.Upstream
+			status.Ahead = branch.Ahead
+			status.Behind = branch.Behind
+		}
+	}
+
+	status.Stashes = r.countStashes()
+
+	// ----------------------------- Index -----------------------------
+
+	err, state.index = r.readIndex()
+	if err != nil {
+		return err, state
+	}
+
+	err, state.staged = r.compareHead(status.Head, state.index)
+	return err, state
+}
+
+// readBranches : Every local branch, with its upstream and the commits between them
+func (r *gitRepository) readBranches(ctx context.Context, config map[string]map[string]string, status *GitStatus) error {
+	heads := r.listRefs("refs/heads/")
+
+	// Commits of the remote branches, for the branches tracking nothing
+	var remotes []string
+	for _, hash := range r.listRefs("refs/remotes/") {
+		remotes = append(remotes, hash)
+	}
+
+	names := make([]string, 0, len(heads))
+	for name := range heads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		branch := GitBranch{Name: name, Head: heads[name]}
+
+		section := config["branch."+name]
+		merge := strings.TrimPrefix(section["merge"], "refs/heads/")
+
+		upstream := ""
+		switch {
+		case merge == "":
+		case section["remote"] == ".":
+			branch.Upstream = merge
+			upstream = r.resolveRef("refs/heads/" + merge)
+		case section["remote"] != "":
+			branch.Upstream = section["remote"] + "/" + merge
+			upstream = r.resolveRef("refs/remotes/" + branch.Upstream)
+		}
+
+		var err error
+		switch {
+		case branch.Upstream != "" && upstream == "":
+			branch.Gone = true
+		case upstream != "":
+			err, branch.Ahead, branch.Behind = r.aheadBehind(ctx, branch.Head, []string{upstream})
+		default:
+			err, branch.Ahead, _ = r.aheadBehind(ctx, branch.Head, remotes)
+		}
+		if err != nil {
+			return err
+		}
+
+		status.Branches = append(status.Branches, branch)
+	}
+
+	return nil
+}
+
+// countStashes : Entries of the stash (its reflog), 1 if the stash exists without a reflog
+func (r *gitRepository) countStashes() int {
+	if r.resolveRef("refs/stash") == "" {
+		return 0
+	}
+
+	data, err := r.fsys.ReadFile(filepath.Join(r.commonDir, "logs", "refs", "stash"))
+	if err != nil {
+		return 1
+	}
+
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return max(count, 1)
+}
+
+// openGitRepository : Find the .git of root or of one of its parents
+func openGitRepository(fsys FileSystem, root string) (error, *gitRepository) {
+	dir := filepath.Clean(root)
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+
+		if info, err := fsys.Stat(dotGit); err == nil {
+			repository := &gitRepository{fsys: fsys, workTree: dir, gitDir: dotGit}
+
+			// Worktrees and submodules : "gitdir: <path>" in a .git file
+			if !info.IsDir() {
+				data, err := fsys.ReadFile(dotGit)
+				if err != nil {
+					return err, nil
+				}
+
+				gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if !ok {
+					return fmt.Errorf("%w: invalid %s", ErrNotGitRepository, dotGit), nil
+				}
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				repository.gitDir = filepath.Clean(gitDir)
+			}
+
+			repository.commonDir = repository.gitDir
+			if data, err := fsys.ReadFile(filepath.Join(repository.gitDir, "commondir")); err == nil {
+				commonDir := strings.TrimSpace(string(data))
+				if !filepath.IsAbs(commonDir) {
+					commonDir = filepath.Join(repository.gitDir, commonDir)
+				}
+				repository.commonDir = filepath.Clean(commonDir)
+			}
+
+			return nil, repository
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ErrNotGitRepository, nil
+		}
+		dir = parent
+	}
+}
+
+func (r *gitRepository) close() {
+	for _, pack := range r.packs {
+		if pack.closer != nil {
+			pack.closer.Close()
+		}
+	}
+}
+
+// readFile : Read a file of the git folder, the one of the worktree first, then the shared one
+func (r *gitRepository) readFile(name string) ([]byte, error) {
+	data, err := r.fsys.ReadFile(filepath.Join(r.gitDir, name))
+	if err != nil && r.commonDir != r.gitDir {
+		data, err = r.fsys.ReadFile(filepath.Join(r.commonDir, name))
+	}
+	return data, err
+}
+
+// ----------------------------- Refs and config -----------------------------
+
+// resolveRef : Commit of a ref (loose, then packed), "" if it doesn't exist
+func (r *gitRepository) resolveRef(name string) string {
+	for i := 0; i < 8; i++ {
+		data, err := r.readFile(name)
+		if err != nil {
+			return r.packedRef(name)
+		}
+
+		value := strings.TrimSpace(string(data))
+
+		// Symbolic ref, like refs/remotes/origin/HEAD
+		target, ok := strings.CutPrefix(value, "ref: ")
+		if !ok {
+			return value
+		}
+		name = target
+	}
+
+	return ""
+}
+
+// packedRef : Commit of a ref in packed-refs, "" if it is not there
+func (r *gitRepository) packedRef(name string) string {
+	data, err := r.fsys.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// Comments, and peeled tags (^<hash>)
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		hash, ref, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && ref == name {
+			return hash
+		}
+	}
+
+	return ""
+}
+
+// listRefs : Commits of the refs starting with prefix (loose, then packed), map[name without the prefix] = commit
+func (r *gitRepository) listRefs(prefix string) map[string]string {
+	refs := make(map[string]string)
+
+	if data, err := r.fsys.ReadFile(filepath.Join(r.commonDir, "packed-refs")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+
+			hash, ref, ok := strings.Cut(strings.TrimSpace(line), " ")
+			if name, found := strings.CutPrefix(ref, prefix); ok && found {
+				refs[name] = hash
+			}
+		}
+	}
+
+	// Loose refs are more recent than the packed ones
+	var walk func(dir string, name string)
+	walk = func(dir string, name string) {
+		entries, err := r.fsys.ReadDir(dir)
+		if err != nil {
+			return
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				walk(filepath.Join(dir, entry.Name()), name+entry.Name()+"/")
+			} else if hash := r.resolveRef(prefix + name + entry.Name()); hash != "" {
+				refs[name+entry.Name()] = hash
+			}
+		}
+	}
+	walk(filepath.Join(r.commonDir, filepath.FromSlash(prefix)), "")
+
+	return refs
+}
+
+// readConfig : Sections of the config of the repository (see parseGitConfig)
+func (r *gitRepository) readConfig() map[string]map[string]string {
+	data, err := r.fsys.ReadFile(filepath.Join(r.commonDir, "config"))
+	if err != nil {
+		return make(map[string]map[string]string)
+	}
+	return parseGitConfig(data)
+}
+
+/*
+parseGitConfig : Sections of a git config file, map[section][key] = value
+Sections with a subsection are named "remote.origin", keys are lower case, the last value of a key wins (like git)
+*/
+func parseGitConfig(data []byte) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	section := ""
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// [section "subsection"]
+		if line[0] == '[' {
+			header := strings.Trim(line, "[]")
+			name, subsection, ok := strings.Cut(header, " ")
+
+			section = strings.ToLower(name)
+			if ok {
+				section += "." + strings.Trim(strings.TrimSpace(subsection), `"`)
+			}
+
+			if _, ok := sections[section]; !ok {
+				sections[section] = make(map[string]string)
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		if sections[section] != nil {
+			sections[section][key] = value
+		}
+	}
+
+	return sections
+}
+
+/*
+readExcludesFile : Rules of core.excludesFile, set by the repository or the user's config ($XDG_CONFIG_HOME/git/ignore by default)
+The config and the ignore file of the user are only read on the OS
+*/
+func (r *gitRepository) readExcludesFile(config map[string]map[string]string) []IgnoreRule {
+	path := config["core"]["excludesfile"]
+
+	if onOS(r.fsys) {
+		home, _ := os.UserHomeDir()
+
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" && home != "" {
+			xdg = filepath.Join(home, ".config")
+		}
+
+		// The user's files, the last one wins, and the repository over them
+		user := ""
+		files := make([]string, 0, 2)
+		if xdg != "" {
+			user = filepath.Join(xdg, "git", "ignore")
+			files = append(files, filepath.Join(xdg, "git", "config"))
+		}
+		if home != "" {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+
+		for _, name := range files {
+			if data, err := os.ReadFile(name); err == nil {
+				if value := parseGitConfig(data)["core"]["excludesfile"]; value != "" {
+					user = value
+				}
+			}
+		}
+
+		if path == "" {
+			path = user
+		}
+		path = TranslateDir(path)
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	data, err := r.fsys.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return ParseIgnoreRules(strings.Split(string(data), "\n"))
+}
+
+// ----------------------------- Ahead and behind -----------------------------
+
+// gitQueue : Commits to visit, the most recent first
+type gitQueue []*gitVisit
+
+type gitVisit struct {
+	hash  string
+	time  int64
+	flags int
+}
+
+func (q gitQueue) Len() int            { return len(q) }
+func (q gitQueue) Less(i, j int) bool  { return q[i].time > q[j].time }
+func (q gitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *gitQueue) Push(x interface{}) { *q = append(*q, x.(*gitVisit)) }
+func (q *gitQueue) Pop() interface{} {
+	old := *q
+	visit := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return visit
+}
+
+/*
+aheadBehind : Count the commits reachable only from head (ahead), and only from the upstreams (behind)
+
+Both histories are walked together, the most recent commits first, marking each commit
+with the side(s) it is reachable from. The walk stops once every commit left to visit
+is reachable from both sides, and none of the commits seen from one side only is as old as them :
+a commit is never more recent than its children, so older commits are shared, but commits of the same
+second can be met in any order, and one seen from one side only may still be below a shared one.
+Without upstreams, every commit of head is ahead.
+*/
+func (r *gitRepository) aheadBehind(ctx context.Context, head string, upstreams []string) (error, int, int) {
+	const fromHead, fromUpstream, fromBoth = 1, 2, 3
+
+	flags := make(map[string]int)
+	times := make(map[string]int64) // Commit time of the commits seen from one side only
+	queue := &gitQueue{}
+
+	push := func(hash string, flag int) error {
+		if flags[hash]&flag == flag {
+			return nil
+		}
+
+		err, commit := r.readCommit(hash)
+		if err != nil {
+			// Shallow clones don't have the oldest commits
+			if errors.Is(err, errGitObjectNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		flags[hash] |= flag
+		if flags[hash] == fromBoth {
+			delete(times, hash)
+		} else {
+			times[hash] = commit.time
+		}
+
+		heap.Push(queue, &gitVisit{hash: hash, time: commit.time, flags: flags[hash]})
+		return nil
+	}
+
+	// stale : Only shared commits are left, and the commits seen from one side only can't be below them
+	stale := func() bool {
+		for _, visit := range *queue {
+			if flags[visit.hash] != fromBoth {
+				return false
+			}
+		}
+
+		newest := (*queue)[0].time
+		for _, commitTime := range times {
+			if commitTime <= newest {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := push(head, fromHead); err != nil {
+		return err, 0, 0
+	}
+	for _, upstream := range upstreams {
+		if err := push(upstream, fromUpstream); err != nil {
+			return err, 0, 0
+		}
+	}
+
+	for queue.Len() > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err(), 0, 0
+		}
+
+		if stale() {
+			break
+		}
+
+		visit := heap.Pop(queue).(*gitVisit)
+
+		err, commit := r.readCommit(visit.hash)
+		if err != nil {
+			return err, 0, 0
+		}
+
+		for _, parent := range commit.parents {
+			if err := push(parent, flags[visit.hash]); err != nil {
+				return err, 0, 0
+			}
+		}
+	}
+
+	ahead, behind := 0, 0
+	for _, flag := range flags {
+		switch flag {
+		case fromHead:
+			ahead++
+		case fromUpstream:
+			behind++
+		}
+	}
+
+	return nil, ahead, behind
+}
+
+// ----------------------------- Index -----------------------------
+
+// gitIndexEntry : A file of the index (or of a tree)
+type gitIndexEntry struct {
+	path  string
+	mode  uint32
+	hash  string
+	size  uint32
+	mtime int64 // Nanoseconds
+}
+
+// gitIndex : Files of .git/index
+type gitIndex struct {
+	entries   map[string]gitIndexEntry // map[path] = entry, of the merged files (stage 0)
+	conflicts map[string]bool          // Paths left unmerged, with entries for the base, ours and theirs (stages 1 to 3)
+}
+
+// readIndex : Files staged in .git/index (versions 2 to 4)
+func (r *gitRepository) readIndex() (error, gitIndex) {
+	index := gitIndex{
+		entries:   make(map[string]gitIndexEntry),
+		conflicts: make(map[string]bool),
+	}
+	entries := index.entries
+
+	data, err := r.fsys.ReadFile(filepath.Join(r.gitDir, "index"))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing was ever staged
+		return nil, index
+	}
+	if err != nil {
+		return err, index
+	}
+
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return errors.New("invalid git index"), index
+	}
+
+	version := binary.BigEndian.Uint32(data[4:])
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	if version < 2 || version > 4 {
+		return fmt.Errorf("unsupported git index version %d", version), index
+	}
+
+	position := 12
+	previous := ""
+
+	for i := 0; i < count; i++ {
+		// ctime, mtime, dev, ino, mode, uid, gid, size, hash, flags
+		if position+62 > len(data) {
+			return errors.New("truncated git index"), index
+		}
+		entry := data[position:]
+
+		flags := binary.BigEndian.Uint16(entry[60:])
+		start := position + 62
+		if version >= 3 && flags&0x4000 != 0 {
+			// Extended flags
+			start += 2
+		}
+
+		var path string
+
+		if version == 4 {
+			// The path is the end of the previous one minus N bytes, plus a suffix
+			strip, n := gitVarint(data[start:])
+			if n <= 0 || strip > len(previous) {
+				return errors.New("invalid git index path"), index
+			}
+			suffix, _, ok := bytes.Cut(data[start+n:], []byte{0})
+			if !ok {
+				return errors.New("invalid git index path"), index
+			}
+
+			path = previous[:len(previous)-strip] + string(suffix)
+			position = start + n + len(suffix) + 1
+		} else {
+			name, _, ok := bytes.Cut(data[start:], []byte{0})
+			if !ok {
+				return errors.New("invalid git index path"), index
+			}
+
+			path = string(name)
+			// Entries are padded with 1 to 8 NUL bytes to a multiple of 8
+			length := start - position + len(name)
+			position += (length + 8) &^ 7
+		}
+
+		previous = path
+
+		stage := int(flags>>12) & 3
+		if stage != 0 {
+			index.conflicts[path] = true
+			continue
+		}
+
+		entries[path] = gitIndexEntry{
+			path:  path,
+			mode:  binary.BigEndian.Uint32(entry[24:]),
+			hash:  hex.EncodeToString(entry[40:60]),
+			size:  binary.BigEndian.Uint32(entry[36:]),
+			mtime: int64(binary.BigEndian.Uint32(entry[8:]))*1e9 + int64(binary.BigEndian.Uint32(entry[12:])),
+		}
+	}
+
+	// A path can't be both merged and in conflict
+	for path := range index.conflicts {
+		delete(entries, path)
+	}
+
+	return nil, index
+}
+
+// gitVarint : Number written with the offset encoding of git (each byte after the first adds one before the shift)
+// Returns the number and the bytes read, 0 if it doesn't end
+func gitVarint(data []byte) (int, int) {
+	value := 0
+	for i, b := range data {
+		if i > 0 {
+			value++
+		}
+		value = value<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+		if i >= 8 {
+			break
+		}
+	}
+	return 0, 0
+}
+
+// compareHead : Paths whose staged version differs from the one of HEAD (added, changed or deleted), conflicts left out
+func (r *gitRepository) compareHead(head string, index gitIndex) (error, []string) {
+	files := make(map[string]gitIndexEntry)
+
+	if head != "" {
+		err, commit := r.readCommit(head)
+		if err != nil {
+			return err, nil
+		}
+		if err := r.readTree(commit.tree, "", files); err != nil {
+			return err, nil
+		}
+	}
+
+	staged := make([]string, 0)
+
+	for path, entry := range index.entries {
+		file, ok := files[path]
+		if !ok || file.hash != entry.hash || file.mode != entry.mode {
+			staged = append(staged, path)
+		}
+	}
+
+	for path := range files {
+		if _, ok := index.entries[path]; !ok && !index.conflicts[path] {
+			staged = append(staged, path)
+		}
+	}
+
+	sort.Strings(staged)
+	return nil, staged
+}
+
+/*
+countFiles : Count the staged, conflicted, modified and untracked files under root
+
+Only root is walked (not the whole work tree), with the ignore rules of git : core.excludesFile,
+.git/info/exclude, and the .gitignore files from the work tree down to root and inside it
+*/
+func (r *gitRepository) countFiles(ctx context.Context, state gitState, root string, status *GitStatus) error {
+	rel, err := filepath.Rel(r.workTree, root)
+	if err != nil {
+		return err
+	}
+	prefix := filepath.ToSlash(rel)
+
+	// under : Check if a path of the index is in the project
+	under := func(path string) bool {
+		return prefix == "." || path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+
+	for _, path := range state.staged {
+		if under(path) {
+			status.Staged++
+		}
+	}
+	for path := range state.index.conflicts {
+		if under(path) {
+			status.Conflicted++
+		}
+	}
+
+	for path, entry := range state.index.entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Submodules have their own status
+		if !under(path) || entry.mode == 0o160000 {
+			continue
+		}
+
+		if r.changed(entry, filepath.Join(r.workTree, filepath.FromSlash(path))) {
+			status.Modified++
+		}
+	}
+
+	// Untracked files : the ones of the project that are neither in the index nor ignored
+	ignore := NewIgnoreMatcher(r.fsys, r.workTree, nil, false)
+	ignore.Add(r.workTree, state.excludes)
+	if data, err := r.readFile(filepath.Join("info", "exclude")); err == nil {
+		ignore.Add(r.workTree, ParseIgnoreRules(strings.Split(string(data), "\n")))
+	}
+
+	// The folders above root, root loads its own
+	parents := make([]string, 0)
+	for dir := filepath.Dir(root); root != r.workTree && isWithin(r.workTree, dir); dir = filepath.Dir(dir) {
+		parents = append(parents, dir)
+		if dir == r.workTree {
+			break
+		}
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		ignore.loadFile(parents[i], GitIgnoreFile)
+	}
+
+	return walkFileSystem(r.fsys, root, 1, true, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+
+		// The repository itself (a file in worktrees and submodules)
+		if info.Name() == ".git" && path != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == root {
+				ignore.loadFile(path, GitIgnoreFile)
+				return nil
+			}
+
+			// Ignored folders, and nested repositories
+			if ignore.Ignored(path, true) {
+				return filepath.SkipDir
+			}
+			if _, err := r.fsys.Stat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+
+			ignore.loadFile(path, GitIgnoreFile)
+			return nil
+		}
+
+		rel, err := filepath.Rel(r.workTree, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if _, ok := state.index.entries[rel]; !ok && !state.index.conflicts[rel] && !ignore.Ignored(path, false) {
+			status.Untracked++
+		}
+
+		return nil
+	}, nil)
+}
+
+// changed : Check if a tracked file differs from its staged version (same size and time means unchanged, like git)
+func (r *gitRepository) changed(entry gitIndexEntry, path string) bool {
+	info, err := r.fsys.Stat(path)
+	if err != nil {
+		return true
+	}
+
+	// Symbolic links are staged as their target
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if entry.mode&0o170000 != 0o120000 {
+			return true
+		}
+		target, err := os.Readlink(path)
+		return err != nil || gitBlobHash([]byte(filepath.ToSlash(target))) != entry.hash
+	}
+
+	if info.IsDir() || uint32(info.Size()) != entry.size {
+		return true
+	}
+
+	if info.ModTime().UnixNano() == entry.mtime {
+		return false
+	}
+
+	// Touched, the content tells
+	data, err := r.fsys.ReadFile(path)
+	return err != nil || gitBlobHash(data) != entry.hash
+}
+
+// gitBlobHash : Name of a blob, the hash of "blob <size>\0<content>"
+func gitBlobHash(data []byte) string {
+	hash := sha1.New()
+	hash.Write([]byte("blob " + strconv.Itoa(len(data)) + "\x00"))
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,508 @@
+package inseki
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ----------------------------- Index -----------------------------
+
+type testIndexEntry struct {
+	path  string
+	stage int
+	size  uint32
+}
+
+// encodeGitVarint : Offset encoding of git (varint.c), used by the paths of index v4
+func encodeGitVarint(value uint64) []byte {
+	encoded := []byte{byte(value & 0x7f)}
+	for value >>= 7; value != 0; value >>= 7 {
+		value--
+		encoded = append([]byte{0x80 | byte(value&0x7f)}, encoded...)
+	}
+	return encoded
+}
+
+// gitIndexData : A .git/index of the version given, entries sorted like git does
+func gitIndexData(version uint32, entries []testIndexEntry) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("DIRC")
+	binary.Write(&buffer, binary.BigEndian, version)
+	binary.Write(&buffer, binary.BigEndian, uint32(len(entries)))
+
+	previous := ""
+	for i, entry := range entries {
+		start := buffer.Len()
+
+		fixed := make([]byte, 62)
+		binary.BigEndian.PutUint32(fixed[8:], uint32(1700000000+i)) // mtime
+		binary.BigEndian.PutUint32(fixed[24:], 0100644)
+		binary.BigEndian.PutUint32(fixed[36:], entry.size)
+		fixed[40] = byte(i + 1) // hash
+
+		flags := uint16(entry.stage)<<12 | uint16(min(len(entry.path), 0xfff))
+		extended := version >= 3 && i%2 == 1 // Some entries with extended flags (intent to add)
+		if extended {
+			flags |= 0x4000
+		}
+		binary.BigEndian.PutUint16(fixed[60:], flags)
+		buffer.Write(fixed)
+		if extended {
+			buffer.Write([]byte{0x20, 0x00})
+		}
+
+		if version == 4 {
+			common := 0
+			for common < len(previous) && common < len(entry.path) && previous[common] == entry.path[common] {
+				common++
+			}
+			buffer.Write(encodeGitVarint(uint64(len(previous) - common)))
+			buffer.WriteString(entry.path[common:])
+			buffer.WriteByte(0)
+		} else {
+			buffer.WriteString(entry.path)
+			length := buffer.Len() - start
+			buffer.Write(make([]byte, (length+8)&^7-length))
+		}
+
+		previous = entry.path
+	}
+
+	// The extensions and the checksum are not read
+	buffer.Write(make([]byte, 20))
+	return buffer.Bytes()
+}
+
+func TestReadIndex(t *testing.T) {
+	long := strings.Repeat("deep/", 40)
+
+	entries := []testIndexEntry{
+		{path: "README.md", size: 10},
+		{path: "conflict.txt", stage: 1},
+		{path: "conflict.txt", stage: 2},
+		{path: "conflict.txt", stage: 3},
+		{path: long + "a.c", size: 1},
+		{path: long + "b.c", size: 2},
+		{path: "src/main.c", size: 3},
+		{path: "src/main.h", size: 4},
+		{path: "src/util/strings.c", size: 5},
+	}
+	want := []string{long + "a.c", long + "b.c", "README.md", "src/main.c", "src/main.h", "src/util/strings.c"}
+	sort.Strings(want)
+
+	for _, version := range []uint32{2, 3, 4} {
+		t.Run("version "+string(rune('0'+version)), func(t *testing.T) {
+			fsys := FromFS(fstest.MapFS{"repo/.git/index": {Data: gitIndexData(version, entries)}})
+			repository := &gitRepository{fsys: fsys, workTree: "repo", gitDir: "repo/.git", commonDir: "repo/.git"}
+
+			err, index := repository.readIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			paths := make([]string, 0)
+			for path := range index.entries {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			if !reflect.DeepEqual(paths, want) {
+				t.Fatalf("entries %q, want %q", paths, want)
+			}
+			if !reflect.DeepEqual(index.conflicts, map[string]bool{"conflict.txt": true}) {
+				t.Errorf("conflicts %v", index.conflicts)
+			}
+
+			entry := index.entries["src/main.h"]
+			if entry.size != 4 || entry.mode != 0100644 || entry.hash != hex.EncodeToString(append([]byte{8}, make([]byte, 19)...)) || entry.mtime != 1700000007*1e9 {
+				t.Errorf("src/main.h read as %+v", entry)
+			}
+		})
+	}
+}
+
+func TestReadIndexErrors(t *testing.T) {
+	valid := gitIndexData(2, []testIndexEntry{{path: "a.txt"}})
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"no index", nil, true},
+		{"signature", append([]byte("DIRX"), valid[4:]...), false},
+		{"version 1", gitIndexData(1, nil), false},
+		{"version 5", gitIndexData(5, nil), false},
+		{"truncated header", valid[:8], false},
+		{"truncated entry", valid[:40], false},
+		{"path without end", valid[:12+62+3], false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := fstest.MapFS{"repo/.git/HEAD": {Data: []byte("ref: refs/heads/main\n")}}
+			if test.data != nil {
+				files["repo/.git/index"] = &fstest.MapFile{Data: test.data}
+			}
+			repository := &gitRepository{fsys: FromFS(files), workTree: "repo", gitDir: "repo/.git", commonDir: "repo/.git"}
+
+			if err, _ := repository.readIndex(); (err == nil) != test.ok {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
+
+// ----------------------------- Objects -----------------------------
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("0123456789abcdef")
+	big := bytes.Repeat([]byte("x"), 0x10000+10)
+
+	tests := []struct {
+		name  string
+		base  []byte
+		delta []byte
+		want  string
+		ok    bool
+	}{
+		{"insert", base, []byte{16, 3, 3, 'x', 'y', 'z'}, "xyz", true},
+		{"copy", base, []byte{16, 4, 0x91, 2, 4}, "2345", true},
+		{"copy and insert", base, []byte{16, 6, 0x91, 10, 3, 3, '-', '-', '-'}, "abc---", true},
+		{"copy without offset", base, []byte{16, 2, 0x90, 2}, "01", true},
+		{"copy, two bytes of size", base, []byte{16, 16, 0xb0, 16, 0}, "0123456789abcdef", true},
+		{"size 0 copies 0x10000 bytes", big, []byte{0x8a, 0x80, 0x04, 0x80, 0x80, 0x04, 0x80}, string(big[:0x10000]), true},
+		{"base size mismatch", base, []byte{15, 1, 1, 'x'}, "", false},
+		{"copy past the base", base, []byte{16, 4, 0x91, 14, 4}, "", false},
+		{"insert past the delta", base, []byte{16, 3, 3, 'x'}, "", false},
+		{"reserved op", base, []byte{16, 1, 0}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, got := applyDelta(test.base, test.delta)
+			if (err == nil) != test.ok {
+				t.Fatalf("error %v", err)
+			}
+			if test.ok && string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// ----------------------------- Repository -----------------------------
+
+// gitFixture : Run git commands in a temporary folder, without the configuration of the user
+type gitFixture struct {
+	t   *testing.T
+	dir string
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	os.Mkdir(home, 0755)
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	return &gitFixture{t: t, dir: dir}
+}
+
+// run : Run git in a folder of the fixture, returns its output
+func (f *gitFixture) run(dir string, args ...string) string {
+	f.t.Helper()
+
+	command := exec.Command("git", append([]string{"-c", "init.defaultBranch=main", "-c", "commit.gpgSign=false"}, args...)...)
+	command.Dir = filepath.Join(f.dir, dir)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func (f *gitFixture) write(name string, content string) {
+	f.t.Helper()
+
+	path := filepath.Join(f.dir, name)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// commit : Change a file and commit it
+func (f *gitFixture) commit(dir string, name string, content string) {
+	f.t.Helper()
+
+	f.write(filepath.Join(dir, name), content)
+	f.run(dir, "add", name)
+	f.run(dir, "commit", "-q", "-m", "change "+name)
+}
+
+// lines : A file big enough for git to store its versions as deltas
+func lines(changed int) string {
+	var builder strings.Builder
+	for i := 0; i < 200; i++ {
+		if i == changed {
+			builder.WriteString("changed line\n")
+		} else {
+			builder.WriteString("line " + strings.Repeat("x", i%7) + "\n")
+		}
+	}
+	return builder.String()
+}
+
+func TestReadGitStatus(t *testing.T) {
+	f := newGitFixture(t)
+
+	f.run("", "init", "-q", "origin")
+	f.commit("origin", "data.txt", lines(-1))
+	f.commit("origin", "data.txt", lines(1))
+
+	f.run("", "clone", "-q", "origin", "clone")
+	f.commit("clone", "data.txt", lines(2))
+	f.commit("clone", "sub/project/main.c", "int main() {}\n")
+	f.commit("origin", "other.txt", "from origin\n")
+	f.run("clone", "fetch", "-q")
+
+	// A branch never pushed, and one whose upstream is gone
+	f.run("clone", "checkout", "-q", "-b", "feature")
+	f.commit("clone", "feature.txt", "feature\n")
+	f.run("clone", "checkout", "-q", "-b", "old", "origin/main")
+	f.run("clone", "config", "branch.old.remote", "origin")
+	f.run("clone", "config", "branch.old.merge", "refs/heads/deleted")
+	f.run("clone", "checkout", "-q", "main")
+
+	// Stash and changes of the work tree
+	f.write("clone/data.txt", lines(3))
+	f.run("clone", "stash", "-q")
+	f.write("clone/data.txt", lines(4))
+	f.write("clone/sub/project/main.c", "int main() { return 1; }\n")
+	f.write("clone/sub/project/new.c", "new\n")
+	f.run("clone", "add", "sub/project/new.c")
+	f.write("clone/sub/project/untracked.c", "untracked\n")
+	f.write("clone/untracked.txt", "untracked\n")
+	f.write("clone/ignored.log", "ignored\n")
+	f.write("home/.config/git/ignore", "*.log\n")
+
+	// Objects packed with deltas
+	f.run("clone", "repack", "-q", "-a", "-d", "-f", "--depth=10", "--window=10")
+
+	tests := []struct {
+		name  string
+		root  string
+		index int // Index version, git's default if 0
+		want  GitStatus
+	}{
+		{"work tree", "clone", 0, GitStatus{Modified: 2, Staged: 1, Untracked: 2}},
+		{"project folder", "clone/sub/project", 0, GitStatus{Modified: 1, Staged: 1, Untracked: 1}},
+		{"index version 4", "clone", 4, GitStatus{Modified: 2, Staged: 1, Untracked: 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.index != 0 {
+				f.run("clone", "update-index", "--index-version", string(rune('0'+test.index)))
+			}
+
+			err, status := ReadGitStatus(context.Background(), nil, filepath.Join(f.dir, test.root))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status.WorkTree != filepath.Join(f.dir, "clone") || status.Branch != "main" || status.Upstream != "origin/main" {
+				t.Errorf("work tree %s, branch %s, upstream %s", status.WorkTree, status.Branch, status.Upstream)
+			}
+			if status.Head != f.run("clone", "rev-parse", "HEAD") {
+				t.Errorf("head %s", status.Head)
+			}
+			if status.Ahead != 2 || status.Behind != 1 {
+				t.Errorf("ahead %d, behind %d, want 2 and 1", status.Ahead, status.Behind)
+			}
+			if status.Remotes["origin"] != filepath.Join(f.dir, "origin") {
+				t.Errorf("remotes %v", status.Remotes)
+			}
+			if status.Stashes != 1 || !status.Dirty || !status.HasLocalWork() {
+				t.Errorf("stashes %d, dirty %v", status.Stashes, status.Dirty)
+			}
+			if status.Modified != test.want.Modified || status.Staged != test.want.Staged || status.Untracked != test.want.Untracked || status.Conflicted != 0 {
+				t.Errorf("modified %d, staged %d, untracked %d, conflicted %d, want %d %d %d 0",
+					status.Modified, status.Staged, status.Untracked, status.Conflicted, test.want.Modified, test.want.Staged, test.want.Untracked)
+			}
+
+			branches := make(map[string]GitBranch)
+			for _, branch := range status.Branches {
+				branches[branch.Name] = branch
+			}
+			if branch := branches["feature"]; branch.Upstream != "" || branch.Ahead != 3 {
+				t.Errorf("feature : %+v, want 3 commits never pushed", branch)
+			}
+			if branch := branches["old"]; !branch.Gone || branch.Upstream != "origin/deleted" {
+				t.Errorf("old : %+v, want its upstream gone", branch)
+			}
+			if branch := branches["main"]; branch.Ahead != 2 || branch.Behind != 1 {
+				t.Errorf("main : %+v", branch)
+			}
+		})
+	}
+}
+
+func TestReadGitObjects(t *testing.T) {
+	f := newGitFixture(t)
+
+	f.run("", "init", "-q", "repo")
+	for i := 0; i < 20; i++ {
+		f.commit("repo", "data.txt", lines(i))
+		if i%5 == 0 {
+			f.commit("repo", "dir/file"+string(rune('a'+i/5))+".txt", lines(i+1))
+		}
+	}
+	f.run("repo", "repack", "-q", "-a", "-d", "-f", "--depth=50", "--window=50")
+	f.commit("repo", "loose.txt", "a loose object\n")
+
+	err, repository := openGitRepository(OSFileSystem, filepath.Join(f.dir, "repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repository.close()
+
+	objects := strings.Fields(f.run("repo", "cat-file", "--batch-all-objects", "--batch-check=%(objectname)"))
+	if len(objects) < 40 {
+		t.Fatalf("%d objects", len(objects))
+	}
+
+	for _, hash := range objects {
+		err, _, data := repository.readObject(hash, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", hash, err)
+		}
+
+		kind := f.run("repo", "cat-file", "-t", hash)
+		command := exec.Command("git", "cat-file", kind, hash)
+		command.Dir = filepath.Join(f.dir, "repo")
+		want, err := command.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s %s read differently (%d bytes, want %d)", kind, hash, len(data), len(want))
+		}
+	}
+
+	if err, _, _ := repository.readObject(strings.Repeat("0", 40), 0); err == nil {
+		t.Error("missing object read")
+	}
+}
+
+func TestReadGitStatusConflict(t *testing.T) {
+	f := newGitFixture(t)
+
+	f.run("", "init", "-q", "repo")
+	f.commit("repo", "a.txt", "base\n")
+	f.run("repo", "checkout", "-q", "-b", "other")
+	f.commit("repo", "a.txt", "other\n")
+	f.run("repo", "checkout", "-q", "main")
+	f.commit("repo", "a.txt", "main\n")
+
+	command := exec.Command("git", "merge", "-q", "other")
+	command.Dir = filepath.Join(f.dir, "repo")
+	if err := command.Run(); err == nil {
+		t.Fatal("merged without a conflict")
+	}
+
+	err, status := ReadGitStatus(context.Background(), nil, filepath.Join(f.dir, "repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Conflicted != 1 || !status.Dirty || status.Staged != 0 {
+		t.Errorf("conflicted %d, dirty %v, staged %d", status.Conflicted, status.Dirty, status.Staged)
+	}
+}
+
+func TestReadGitStatusOutside(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{"plain/file.txt": {}})
+
+	if err, _ := ReadGitStatus(context.Background(), fsys, "plain"); err != ErrNotGitRepository {
+		t.Errorf("error %v, want ErrNotGitRepository", err)
+	}
+}
+
+func TestReadGitStatusSameTime(t *testing.T) {
+	tests := []struct {
+		base, ahead, behind int
+	}{
+		{3, 1, 2},
+		{3, 1, 3},
+		{3, 3, 1},
+		{1, 0, 2},
+		{4, 2, 2},
+		{2, 5, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d ahead, %d behind", test.ahead, test.behind), func(t *testing.T) {
+			f := newGitFixture(t)
+
+			// Every commit in the same second, so the dates can't tell the shared ones apart
+			t.Setenv("GIT_AUTHOR_DATE", "2024-01-01T00:00:00Z")
+			t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+
+			f.run("", "init", "-q", "origin")
+			for i := 0; i < test.base; i++ {
+				f.commit("origin", "base.txt", fmt.Sprintf("base %d\n", i))
+			}
+
+			f.run("", "clone", "-q", "origin", "clone")
+			for i := 0; i < test.ahead; i++ {
+				f.commit("clone", "ahead.txt", fmt.Sprintf("ahead %d\n", i))
+			}
+			for i := 0; i < test.behind; i++ {
+				f.commit("origin", "behind.txt", fmt.Sprintf("behind %d\n", i))
+			}
+			f.run("clone", "fetch", "-q")
+
+			want := fmt.Sprintf("%d\t%d", test.ahead, test.behind)
+			if counts := f.run("clone", "rev-list", "--left-right", "--count", "HEAD...origin/main"); counts != want {
+				t.Fatalf("git counts %q, want %q", counts, want)
+			}
+
+			for run := 0; run < 20; run++ {
+				err, status := ReadGitStatus(context.Background(), nil, filepath.Join(f.dir, "clone"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status.Ahead != test.ahead || status.Behind != test.behind {
+					t.Fatalf("ahead %d, behind %d, want %d and %d", status.Ahead, status.Behind, test.ahead, test.behind)
+				}
+				if status.HasLocalWork() != (test.ahead > 0) {
+					t.Errorf("local work %v with %d commits ahead", status.HasLocalWork(), test.ahead)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package inseki
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of the objects stored in a pack
+const (
+	gitCommit   = 1
+	gitTree     = 2
+	gitBlob     = 3
+	gitTag      = 4
+	gitOfsDelta = 6
+	gitRefDelta = 7
+)
+
+// gitObjectTypes : Types of the loose objects, by name
+var gitObjectTypes = map[string]int{"commit": gitCommit, "tree": gitTree, "blob": gitBlob, "tag": gitTag}
+
+var errGitObjectNotFound = errors.New("object not found")
+
+// gitPack : A pack of objects and its index (objects/pack/pack-*.pack and .idx)
+type gitPack struct {
+	index []byte
+	count int
+
+	data   io.ReaderAt
+	closer io.Closer
+}
+
+// ----------------------------- Packs -----------------------------
+
+// loadPacks : Read the indexes of the packs, the packs themselves are read on demand
+func (r *gitRepository) loadPacks() {
+	if r.packsLoaded {
+		return
+	}
+	r.packsLoaded = true
+
+	dir := filepath.Join(r.commonDir, "objects", "pack")
+	entries, err := r.fsys.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".idx") {
+			continue
+		}
+
+		index, err := r.fsys.ReadFile(filepath.Join(dir, entry.Name()))
+		// Only the version 2 of the index is written since git 1.5.2
+		if err != nil || len(index) < 8+256*4 || !bytes.Equal(index[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+			continue
+		}
+
+		pack := &gitPack{
+			index: index,
+			count: int(binary.BigEndian.Uint32(index[8+255*4:])),
+		}
+
+		name := filepath.Join(dir, strings.TrimSuffix(entry.Name(), ".idx")+".pack")
+
+		// Packs can be big, they are read in place when possible
+		if onOS(r.fsys) {
+			if file, err := os.Open(name); err == nil {
+				pack.data = file
+				pack.closer = file
+			}
+		}
+		if pack.data == nil {
+			data, err := r.fsys.ReadFile(name)
+			if err != nil {
+				continue
+			}
+			pack.data = bytes.NewReader(data)
+		}
+
+		r.packs = append(r.packs, pack)
+	}
+}
+
+// find : Offset of an object in the pack
+func (p *gitPack) find(hash []byte) (int64, bool) {
+	hashes := 8 + 256*4
+	offsets := hashes + p.count*20 + p.count*4
+	large := offsets + p.count*4
+
+	if len(p.index) < large {
+		return 0, false
+	}
+
+	// The fanout table gives the range of the hashes starting with the same byte
+	start := 0
+	if hash[0] > 0 {
+		start = int(binary.BigEndian.Uint32(p.index[8+(int(hash[0])-1)*4:]))
+	}
+	end := int(binary.BigEndian.Uint32(p.index[8+int(hash[0])*4:]))
+
+	i := start + sort.Search(end-start, func(i int) bool {
+		return bytes.Compare(p.index[hashes+(start+i)*20:hashes+(start+i)*20+20], hash) >= 0
+	})
+	if i >= end || !bytes.Equal(p.index[hashes+i*20:hashes+i*20+20], hash) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(p.index[offsets+i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+
+	// Packs bigger than 2 GiB store the offsets in another table
+	position := large + int(offset&0x7fffffff)*8
+	if len(p.index) < position+8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.index[position:])), true
+}
+
+// readPacked : Read an object of a pack, resolving the deltas
+func (r *gitRepository) readPacked(p *gitPack, offset int64, depth int) (error, int, []byte) {
+	if depth > 64 {
+		return errors.New("delta chain too long"), 0, nil
+	}
+
+	header := make([]byte, 32)
+	n, err := p.data.ReadAt(header, offset)
+	if n == 0 {
+		return err, 0, nil
+	}
+	header = header[:n]
+
+	// Type and size : 3 bits of type, then the size by 7 bits
+	i := 0
+	kind := int(header[0]>>4) & 7
+	size := int64(header[0] & 0x0f)
+	for shift := 4; header[i]&0x80 != 0; shift += 7 {
+		i++
+		if i >= len(header) {
+			return errors.New("invalid pack header"), 0, nil
+		}
+		size |= int64(header[i]&0x7f) << shift
+	}
+	i++
+
+	var base []byte
+	var baseKind int
+
+	switch kind {
+	case gitOfsDelta:
+		// Offset of the base, backwards from this object
+		if i >= len(header) {
+			return errors.New("invalid delta offset"), 0, nil
+		}
+		rel := int64(header[i] & 0x7f)
+		for header[i]&0x80 != 0 {
+			i++
+			if i >= len(header) {
+				return errors.New("invalid delta offset"), 0, nil
+			}
+			rel = ((rel + 1) << 7) | int64(header[i]&0x7f)
+		}
+		i++
+
+		if err, baseKind, base = r.readPacked(p, offset-rel, depth+1); err != nil {
+			return err, 0, nil
+		}
+
+	case gitRefDelta:
+		if i+20 > len(header) {
+			return errors.New("invalid delta base"), 0, nil
+		}
+		if err, baseKind, base = r.readObject(hex.EncodeToString(header[i:i+20]), depth+1); err != nil {
+			return err, 0, nil
+		}
+		i += 20
+	}
+
+	reader, err := zlib.NewReader(io.NewSectionReader(p.data, offset+int64(i), 1<<62))
+	if err != nil {
+		return err, 0, nil
+	}
+	defer reader.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return err, 0, nil
+	}
+
+	if base == nil {
+		return nil, kind, data
+	}
+
+	err, data = applyDelta(base, data)
+	return err, baseKind, data
+}
+
+// applyDelta : Rebuild an object from its base and a delta (copies from the base and inserted bytes)
+func applyDelta(base []byte, delta []byte) (error, []byte) {
+	i := 0
+
+	readSize := func() int {
+		size, shift := 0, 0
+		for i < len(delta) {
+			b := delta[i]
+			i++
+			size |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return size
+	}
+
+	if readSize() != len(base) {
+		return errors.New("delta base size mismatch"), nil
+	}
+	result := make([]byte, 0, readSize())
+
+	for i < len(delta) {
+		op := delta[i]
+		i++
+
+		if op&0x80 == 0 {
+			// Insert the next op bytes
+			if op == 0 || i+int(op) > len(delta) {
+				return errors.New("invalid delta"), nil
+			}
+			result = append(result, delta[i:i+int(op)]...)
+			i += int(op)
+			continue
+		}
+
+		// Copy from the base : the bits of op tell which bytes of the offset and size follow
+		offset, size := 0, 0
+		for bit := 0; bit < 4; bit++ {
+			if op&(1<<bit) != 0 && i < len(delta) {
+				offset |= int(delta[i]) << (8 * bit)
+				i++
+			}
+		}
+		for bit := 0; bit < 3; bit++ {
+			if op&(0x10<<bit) != 0 && i < len(delta) {
+				size |= int(delta[i]) << (8 * bit)
+				i++
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return errors.New("invalid delta copy"), nil
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+
+	return nil, result
+}
+
+// ----------------------------- Objects -----------------------------
+
+// readObject : Read an object, loose or packed, returns its type and its content
+func (r *gitRepository) readObject(hash string, depth int) (error, int, []byte) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return fmt.Errorf("invalid object name %q", hash), 0, nil
+	}
+
+	// Loose object : objects/ab/cdef..., compressed "<type> <size>\0<content>"
+	if compressed, err := r.fsys.ReadFile(filepath.Join(r.commonDir, "objects", hash[:2], hash[2:])); err == nil {
+		reader, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return err, 0, nil
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err, 0, nil
+		}
+
+		header, content, ok := bytes.Cut(data, []byte{0})
+		if !ok {
+			return fmt.Errorf("invalid object %s", hash), 0, nil
+		}
+
+		name, _, _ := strings.Cut(string(header), " ")
+		return nil, gitObjectTypes[name], content
+	}
+
+	r.loadPacks()
+	for _, pack := range r.packs {
+		if offset, ok := pack.find(raw); ok {
+			return r.readPacked(pack, offset, depth)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errGitObjectNotFound, hash), 0, nil
+}
+
+// gitCommitInfo : What the history walk needs from a commit
+type gitCommitInfo struct {
+	tree    string
+	parents []string
+	time    int64 // Committer time
+}
+
+func (r *gitRepository) readCommit(hash string) (error, gitCommitInfo) {
+	err, kind, data := r.readObject(hash, 0)
+	if err != nil {
+		return err, gitCommitInfo{}
+	}
+	if kind != gitCommit {
+		return fmt.Errorf("%s is not a commit", hash), gitCommitInfo{}
+	}
+
+	var commit gitCommitInfo
+
+	// Headers, until the empty line before the message
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.tree = value
+		case "parent":
+			commit.parents = append(commit.parents, value)
+		case "committer":
+			// Name <email> <time> <zone>
+			fields := strings.Fields(value)
+			if len(fields) >= 2 {
+				commit.time, _ = strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			}
+		}
+	}
+
+	return nil, commit
+}
+
+// readTree : Files of a tree and its sub trees, map[path] = mode and hash
+func (r *gitRepository) readTree(hash string, prefix string, files map[string]gitIndexEntry) error {
+	err, kind, data := r.readObject(hash, 0)
+	if err != nil {
+		return err
+	}
+	if kind != gitTree {
+		return fmt.Errorf("%s is not a tree", hash)
+	}
+
+	// Entries : "<mode> <name>\0<20 bytes hash>"
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			return fmt.Errorf("invalid tree %s", hash)
+		}
+
+		mode, name, _ := strings.Cut(string(header), " ")
+		entryHash := hex.EncodeToString(rest[:20])
+		data = rest[20:]
+
+		modeValue, _ := strconv.ParseUint(mode, 8, 32)
+
+		if modeValue == 0o40000 {
+			if err := r.readTree(entryHash, prefix+name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+
+		files[prefix+name] = gitIndexEntry{path: prefix + name, mode: uint32(modeValue), hash: entryHash}
+	}
+
+	return nil
+}
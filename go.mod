@@ -1,3 +1,3 @@
 module github.com/ForkBench/Inseki-Core
 
-go 1.22.4
+go 1.23
@@ -0,0 +1,95 @@
+package inseki
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// NestedPolicy : Which projects to report when projects are nested in each other
+type NestedPolicy string
+
+const (
+	// NestedAll : Report every project, linked to its enclosing and nested projects
+	NestedAll NestedPolicy = "all"
+	// NestedOutermost : Only report projects that are not inside another project
+	NestedOutermost NestedPolicy = "outermost"
+	// NestedInnermost : Only report projects that do not contain another project
+	NestedInnermost NestedPolicy = "innermost"
+)
+
+// IsValid : Check if the policy is known (an empty policy means NestedAll)
+func (p NestedPolicy) IsValid() bool {
+	switch p {
+	case "", NestedAll, NestedOutermost, NestedInnermost:
+		return true
+	}
+	return false
+}
+
+// linkProjects : Fill Parent and Nested of each response, then apply the policy
+func linkProjects(responses []Response, policy NestedPolicy) []Response {
+	roots := make(map[string]bool)
+	for _, response := range responses {
+		roots[response.Root] = true
+	}
+
+	// map[root] = closest enclosing root
+	parents := make(map[string]string)
+	// map[root] = roots directly nested in it
+	nested := make(map[string][]string)
+
+	for root := range roots {
+		parent := enclosingRoot(root, roots)
+		if parent == "" {
+			continue
+		}
+
+		parents[root] = parent
+		nested[parent] = append(nested[parent], root)
+	}
+
+	for _, children := range nested {
+		sort.Strings(children)
+	}
+
+	results := make([]Response, 0, len(responses))
+
+	for _, response := range responses {
+		response.Parent = parents[response.Root]
+		// Each response gets its own copy, changing one doesn't change the others
+		response.Nested = append([]string(nil), nested[response.Root]...)
+
+		switch policy {
+		case NestedOutermost:
+			if response.Parent != "" {
+				continue
+			}
+		case NestedInnermost:
+			if len(response.Nested) > 0 {
+				continue
+			}
+		}
+
+		results = append(results, response)
+	}
+
+	return results
+}
+
+// enclosingRoot : Closest root containing the given root, "" if there is none
+func enclosingRoot(root string, roots map[string]bool) string {
+	dir := root
+
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		if roots[parent] {
+			return parent
+		}
+
+		dir = parent
+	}
+}
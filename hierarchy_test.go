@@ -0,0 +1,67 @@
+package inseki
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinkProjects(t *testing.T) {
+	j := filepath.Join
+	responses := []Response{
+		{Root: j("/d", "course"), Structure: Structure{ID: "course.json"}},
+		{Root: j("/d", "course", "TP1"), Structure: Structure{ID: "lab.json"}},
+		{Root: j("/d", "course", "TP1"), Structure: Structure{ID: "c.json"}},
+		{Root: j("/d", "course", "TP1", "lib", "vendored"), Structure: Structure{ID: "c.json"}},
+		{Root: j("/d", "course", "TP2"), Structure: Structure{ID: "lab.json"}},
+		{Root: j("/d", "course-old"), Structure: Structure{ID: "course.json"}},
+	}
+
+	tests := []struct {
+		policy NestedPolicy
+		want   []string // Root, parent and nested of each response kept
+	}{
+		{NestedAll, []string{
+			"/d/course  [/d/course/TP1 /d/course/TP2]",
+			"/d/course/TP1 /d/course [/d/course/TP1/lib/vendored]",
+			"/d/course/TP1 /d/course [/d/course/TP1/lib/vendored]",
+			"/d/course/TP1/lib/vendored /d/course/TP1 []",
+			"/d/course/TP2 /d/course []",
+			"/d/course-old  []",
+		}},
+		{"", nil}, // Same as NestedAll
+		{NestedOutermost, []string{"/d/course  [/d/course/TP1 /d/course/TP2]", "/d/course-old  []"}},
+		{NestedInnermost, []string{"/d/course/TP1/lib/vendored /d/course/TP1 []", "/d/course/TP2 /d/course []", "/d/course-old  []"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			want := test.want
+			if want == nil {
+				want = tests[0].want
+			}
+
+			got := make([]string, 0)
+			for _, response := range linkProjects(responses, test.policy) {
+				got = append(got, filepath.ToSlash(fmt.Sprintf("%s %s %v", response.Root, response.Parent, response.Nested)))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLinkProjectsCopiesNested(t *testing.T) {
+	responses := linkProjects([]Response{
+		{Root: "/p", Structure: Structure{ID: "a.json"}},
+		{Root: "/p", Structure: Structure{ID: "b.json"}},
+		{Root: "/p/q", Structure: Structure{ID: "a.json"}},
+	}, NestedAll)
+
+	responses[0].Nested[0] = "changed"
+	if responses[1].Nested[0] != "/p/q" {
+		t.Errorf("the responses of a root share their nested roots")
+	}
+}
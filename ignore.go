@@ -0,0 +1,246 @@
+package inseki
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// InsekiIgnoreFile : Name of the ignore files, in the inseki folder and in any scanned folder
+const InsekiIgnoreFile = ".insekiignore"
+
+// GitIgnoreFile : Name of the git ignore files, read with WalkOptions.GitIgnore
+const GitIgnoreFile = ".gitignore"
+
+// gitExcludeFile : Ignore rules of a repository that are not committed, relative to the work tree
+var gitExcludeFile = filepath.Join(".git", "info", "exclude")
+
+// IgnoreRule : A single line of an ignore file, with the gitignore semantics
+type IgnoreRule struct {
+	Pattern  string
+	Negate   bool // "!pattern" : re-include what a previous rule excluded
+	DirOnly  bool // "pattern/" : only matches folders
+	Anchored bool // "/pattern" or "a/pattern" : relative to the folder of the ignore file
+
+	regex *regexp.Regexp
+}
+
+// ParseIgnoreRules : Parse the lines of an ignore file (comments and blank lines are skipped)
+func ParseIgnoreRules(lines []string) []IgnoreRule {
+	rules := make([]IgnoreRule, 0, len(lines))
+
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(line); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+func parseIgnoreRule(line string) (IgnoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored, unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnoreRule{}, false
+	}
+
+	rule := IgnoreRule{}
+
+	if strings.HasPrefix(line, "!") {
+		rule.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.DirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern
+	if strings.Contains(line, "/") {
+		rule.Anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return IgnoreRule{}, false
+	}
+
+	rule.Pattern = line
+
+	regex, err := regexp.Compile(ignorePatternToRegex(line, rule.Anchored))
+	if err != nil {
+		return IgnoreRule{}, false
+	}
+	rule.regex = regex
+
+	return rule, true
+}
+
+// ignorePatternToRegex : Translate a gitignore pattern to a regular expression on a slash separated relative path
+func ignorePatternToRegex(pattern string, anchored bool) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+
+	// Not anchored : matches at any level
+	if !anchored {
+		builder.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			// Zero or more folders
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern) && (i == 0 || pattern[i-1] == '/'):
+			// Everything inside
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			builder.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	builder.WriteString("$")
+	return builder.String()
+}
+
+// Match : Check if a path (slash separated, relative to the folder of the ignore file) matches the rule
+func (r IgnoreRule) Match(rel string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	return r.regex.MatchString(rel)
+}
+
+// ----------------------------- Matcher -----------------------------
+
+// IgnoreMatcher : Rules of the ignore files met during a walk, each one applying to its own folder
+//
+// For each folder from the root to the path, rules are applied in this order (the last matching one wins) :
+//  1. the global rules (root folder only)
+//  2. .git/info/exclude, if the folder is a git work tree (with gitIgnore)
+//  3. .gitignore (with gitIgnore)
+//  4. .insekiignore
+//
+// So a .insekiignore can re-include (!target/) what git ignores in the same folder, and deeper files override upper ones
+type IgnoreMatcher struct {
+	fsys      FileSystem
+	root      string
+	gitIgnore bool
+
+	mu    sync.RWMutex
+	rules map[string][]IgnoreRule // map[folder] = rules
+}
+
+// NewIgnoreMatcher : Create a matcher for a walk starting at root, with global rules relative to root
+// With gitIgnore, .gitignore and .git/info/exclude files are read too
+func NewIgnoreMatcher(fsys FileSystem, root string, global []string, gitIgnore bool) *IgnoreMatcher {
+	matcher := &IgnoreMatcher{
+		fsys:      fsys,
+		root:      filepath.Clean(root),
+		gitIgnore: gitIgnore,
+		rules:     make(map[string][]IgnoreRule),
+	}
+
+	matcher.Add(matcher.root, ParseIgnoreRules(global))
+
+	return matcher
+}
+
+// Add : Add rules applying to a folder and its content
+func (m *IgnoreMatcher) Add(dir string, rules []IgnoreRule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	dir = filepath.Clean(dir)
+
+	m.mu.Lock()
+	m.rules[dir] = append(m.rules[dir], rules...)
+	m.mu.Unlock()
+}
+
+// LoadDir : Read the ignore files of a folder, if there are some
+func (m *IgnoreMatcher) LoadDir(dir string) {
+	if m.gitIgnore {
+		m.loadFile(dir, gitExcludeFile)
+		m.loadFile(dir, GitIgnoreFile)
+	}
+
+	m.loadFile(dir, InsekiIgnoreFile)
+}
+
+// loadFile : Read an ignore file, relative to dir, whose rules apply to dir
+func (m *IgnoreMatcher) loadFile(dir string, name string) {
+	data, err := m.fsys.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return
+	}
+
+	m.Add(dir, ParseIgnoreRules(strings.Split(string(data), "\n")))
+}
+
+// Ignored : Check if a path is ignored, the last matching rule wins (deeper files come last)
+func (m *IgnoreMatcher) Ignored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ignored := false
+
+	// Folders from the root to the parent of the path
+	dir := m.root
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	for i := range parts {
+		relToDir := strings.Join(parts[i:], "/")
+
+		for _, rule := range m.rules[dir] {
+			if rule.Match(relToDir, isDir) {
+				ignored = !rule.Negate
+			}
+		}
+
+		dir = filepath.Join(dir, parts[i])
+	}
+
+	return ignored
+}
@@ -0,0 +1,181 @@
+package inseki
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	tests := []struct {
+		line  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/sub/notes.txt", false, false},
+		{"doc/*.txt", "other/doc/notes.txt", false, false},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"out/**", "out/x/y", false, true},
+		{"out/**", "out", true, false},
+		{"?.txt", "a.txt", false, true},
+		{"?.txt", "ab.txt", false, false},
+		{"[ab].c", "a.c", false, true},
+		{"[!ab].c", "a.c", false, false},
+		{"[!ab].c", "c.c", false, true},
+		{"\\#file", "#file", false, true},
+		{"\\!important", "!important", false, true},
+		{"trailing   ", "trailing", false, true},
+		{"escaped\\ ", "escaped ", false, true},
+		{"a.b", "axb", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line+" "+test.path, func(t *testing.T) {
+			rules := ParseIgnoreRules([]string{test.line})
+			if len(rules) != 1 {
+				t.Fatalf("%q gave %d rules", test.line, len(rules))
+			}
+			if got := rules[0].Match(test.path, test.isDir); got != test.want {
+				t.Errorf("%q matching %q (dir %v) = %v, want %v", test.line, test.path, test.isDir, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreRules(t *testing.T) {
+	tests := []struct {
+		line  string
+		rules int
+		rule  IgnoreRule
+	}{
+		{"", 0, IgnoreRule{}},
+		{"# comment", 0, IgnoreRule{}},
+		{"   ", 0, IgnoreRule{}},
+		{"/", 0, IgnoreRule{}},
+		{"!keep.txt", 1, IgnoreRule{Pattern: "keep.txt", Negate: true}},
+		{"target/", 1, IgnoreRule{Pattern: "target", DirOnly: true}},
+		{"/target", 1, IgnoreRule{Pattern: "target", Anchored: true}},
+		{"a/b/", 1, IgnoreRule{Pattern: "a/b", DirOnly: true, Anchored: true}},
+		{"windows\r", 1, IgnoreRule{Pattern: "windows"}},
+	}
+
+	for _, test := range tests {
+		rules := ParseIgnoreRules([]string{test.line})
+		if len(rules) != test.rules {
+			t.Errorf("%q gave %d rules, want %d", test.line, len(rules), test.rules)
+			continue
+		}
+		if test.rules == 0 {
+			continue
+		}
+
+		rule := rules[0]
+		if rule.Pattern != test.rule.Pattern || rule.Negate != test.rule.Negate || rule.DirOnly != test.rule.DirOnly || rule.Anchored != test.rule.Anchored {
+			t.Errorf("%q = %+v, want %+v", test.line, rule, test.rule)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"root/.insekiignore":            {Data: []byte("*.log\ntarget/\n!keep.log\nsecret\n")},
+		"root/sub/.insekiignore":        {Data: []byte("/only-here\n!debug.log\n")},
+		"root/sub/deeper/.insekiignore": {Data: []byte("*.tmp\n")},
+	})
+
+	tests := []struct {
+		name  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"rule of the root", "root/debug.log", false, true},
+		{"negation in the same file", "root/keep.log", false, false},
+		{"folder only", "root/target", true, true},
+		{"folder only, file", "root/target", false, false},
+		{"plain name", "root/secret", false, true},
+		{"anchored to its folder", "root/sub/only-here", false, true},
+		{"anchored, other folder", "root/only-here", false, false},
+		{"anchored, deeper folder", "root/sub/x/only-here", false, false},
+		{"deeper file overrides", "root/sub/debug.log", false, false},
+		{"deeper file overrides, below it", "root/sub/x/debug.log", false, false},
+		{"upper rules still apply", "root/sub/other.log", false, true},
+		{"rules of a deeper folder", "root/sub/deeper/a.tmp", false, true},
+		{"rules of a deeper folder, above it", "root/sub/a.tmp", false, false},
+		{"global rules", "root/sub/global.bak", false, true},
+		{"the root itself", "root", true, false},
+		{"outside the root", "other/debug.log", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher := NewIgnoreMatcher(fsys, "root", []string{"*.bak"}, false)
+			for _, dir := range []string{"root", "root/sub", "root/sub/deeper"} {
+				matcher.LoadDir(dir)
+			}
+
+			if got := matcher.Ignored(test.path, test.isDir); got != test.want {
+				t.Errorf("Ignored(%s) = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherGitIgnore(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"root/.gitignore":        {Data: []byte("*.log\ntarget/\n!keep.log\n")},
+		"root/.insekiignore":     {Data: []byte("!target/\nsecret\n")},
+		"root/.git/info/exclude": {Data: []byte("local/\n!notes.log\n")},
+		"root/sub/.gitignore":    {Data: []byte("/only-here\n!debug.log\nlocal-too/\n")},
+		"root/sub/.insekiignore": {Data: []byte("other.log\n")},
+	})
+
+	tests := []struct {
+		name      string
+		gitIgnore bool
+		path      string
+		isDir     bool
+		want      bool
+	}{
+		{"git ignore read", true, "root/debug.log", false, true},
+		{"git ignore skipped", false, "root/debug.log", false, false},
+		{"negation in the same file", true, "root/keep.log", false, false},
+		{".gitignore overrides info/exclude", true, "root/notes.log", false, true},
+		{"inseki re-includes what git ignores", true, "root/target", true, false},
+		{"inseki ignore with git", true, "root/secret", false, true},
+		{"git exclude", true, "root/local", true, true},
+		{"git exclude skipped", false, "root/local", true, false},
+		{"git exclude, deeper folder", true, "root/sub/local", true, true},
+		{"anchored to its folder", true, "root/sub/only-here", false, true},
+		{"anchored, other folder", true, "root/only-here", false, false},
+		{"deeper .gitignore overrides", true, "root/sub/debug.log", false, false},
+		{"deeper .gitignore", true, "root/sub/local-too", true, true},
+		{"deeper .gitignore skipped", false, "root/sub/local-too", true, false},
+		{".insekiignore after .gitignore", true, "root/sub/other.log", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher := NewIgnoreMatcher(fsys, "root", nil, test.gitIgnore)
+			for _, dir := range []string{"root", "root/sub"} {
+				matcher.LoadDir(dir)
+			}
+
+			if got := matcher.Ignored(test.path, test.isDir); got != test.want {
+				t.Errorf("Ignored(%s) = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
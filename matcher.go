@@ -0,0 +1,261 @@
+package inseki
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// Matcher : Shared state used to check structures against the disk
+type Matcher struct {
+	Dirs *DirCache
+	Memo *MatchMemo
+
+	// Unreadable folders and invalid patterns, nothing is recorded if nil
+	Errors *ErrorReport
+}
+
+// NewMatcher : Create a matcher with empty caches, reading folders from fsys
+func NewMatcher(fsys FileSystem) *Matcher {
+	return &Matcher{
+		Dirs: NewDirCache(fsys),
+		Memo: NewMatchMemo(),
+	}
+}
+
+// Forget : Drop what is cached about a folder, its listing and the structures checked from it
+func (m *Matcher) Forget(dir string) {
+	m.Dirs.Forget(dir)
+	m.Memo.Forget(dir)
+}
+
+// MatchStructure : Check if a Structure matches a file
+// Returns the root of the structure
+func (m *Matcher) MatchStructure(s Structure, path string) (bool, string) {
+	/*
+		The idea is the following :
+
+		We have a Structure, and a match (for example, ~/home/dev/main.c)
+
+		We need to check if **all** folders and files that are non-optional in the structure are contained around this file.
+
+		1. First, we need to determine where is the detected file/folder in the structure (which depth)
+
+		Ex : {
+			README
+			src {
+				main.c
+			}
+		}
+
+		-> main.c is at depth 1 (we need one "../" to go back to the root)
+
+		2. Second, we need to go to the possible root folder
+		3. See if the structure matches from the root
+
+		/!\ There could be multiple depth :
+
+		{
+			README
+			src {
+				main.c
+			}
+			main.c
+		}
+
+		-> main.c is at two different depths
+
+		Many files share the same candidate root (every .c of a folder), so each
+		(structure, root) pair is only evaluated once thanks to the memo.
+	*/
+
+	path = filepath.Clean(path)
+
+	// Get the depth of the file
+	depths := s.GetDepths(filepath.Base(path))
+
+	for _, depth := range depths {
+		root := GoUp(path, depth)
+
+		matched := m.Memo.Lookup(s, root, func() bool {
+			return m.MatchNode(s.Root, root)
+		})
+
+		if matched {
+			return true, root
+		}
+	}
+
+	return false, ""
+}
+
+// MatchNode : Check if a Node matches a folder
+func (m *Matcher) MatchNode(n Node, root string) bool {
+	// Has to match from the root
+
+	// If the current node is a file, check if the folder contains it
+	if !n.IsDirectory {
+		return m.hasEntry(root, n.Name)
+	}
+
+	// If the current node is a directory
+	// Check if the root is the same as the name
+	if matched, _ := filepath.Match(n.Name, filepath.Base(root)); matched {
+		// Check if the children match (all non optional children need to be present)
+		for _, child := range n.Children {
+			// If the child is optional, skip
+			if child.Optional {
+				continue
+			}
+
+			if !child.IsDirectory {
+				// Check if the child is in the root
+				if !m.MatchNode(child, root) {
+					return false
+				}
+			} else {
+				// Check if a folder of the root satisfies the child (its name could be a pattern like TP*)
+				if !m.matchDirectoryChild(child, root) {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// matchDirectoryChild : Check the folders of root whose name matches a directory child
+// By default one matching folder is enough, with MatchAll every matching folder has to satisfy the child
+func (m *Matcher) matchDirectoryChild(child Node, root string) bool {
+	entries, err := m.Dirs.ReadDir(root)
+	if err != nil {
+		m.recordError(root, err)
+		return false
+	}
+
+	found := false
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		matched, err := filepath.Match(child.Name, entry.Name())
+		if err != nil {
+			m.recordError(root, fmt.Errorf("pattern %q: %w", child.Name, err))
+			return false
+		}
+		if !matched {
+			continue
+		}
+
+		if m.MatchNode(child, filepath.Join(root, entry.Name())) {
+			found = true
+
+			if !child.MatchAll {
+				return true
+			}
+		} else if child.MatchAll {
+			return false
+		}
+	}
+
+	return found
+}
+
+// NodeMatch : Files or folders satisfying a node of a structure
+type NodeMatch struct {
+	Node  string   `json:"node"`  // Path of the node from the root node, like "*/src/*.c"
+	Paths []string `json:"paths"` // Matching files or folders
+}
+
+// Collect : Files and folders of a root satisfying each node of a structure, optional ones included when present
+// The structure is expected to match the root (see MatchStructure), nodes without any file are left out
+func (m *Matcher) Collect(s Structure, root string) []NodeMatch {
+	matches := make([]NodeMatch, 0)
+	index := make(map[string]int)
+
+	add := func(node string, path string) {
+		i, ok := index[node]
+		if !ok {
+			i = len(matches)
+			index[node] = i
+			matches = append(matches, NodeMatch{Node: node})
+		}
+		matches[i].Paths = append(matches[i].Paths, path)
+	}
+
+	var collect func(n Node, node string, dir string)
+	collect = func(n Node, node string, dir string) {
+		entries, err := m.Dirs.ReadDir(dir)
+		if err != nil {
+			m.recordError(dir, err)
+			return
+		}
+
+		for _, child := range n.Children {
+			childNode := node + "/" + child.Name
+
+			for _, entry := range entries {
+				if matched, _ := filepath.Match(child.Name, entry.Name()); !matched {
+					continue
+				}
+
+				path := filepath.Join(dir, entry.Name())
+
+				if !child.IsDirectory {
+					add(childNode, path)
+					continue
+				}
+
+				// Same rule as matchDirectoryChild : only the folders satisfying the child
+				if entry.IsDir() && m.MatchNode(child, path) {
+					add(childNode, path)
+					collect(child, childNode, path)
+				}
+			}
+		}
+	}
+
+	add(s.Root.Name, root)
+	if s.Root.IsDirectory {
+		collect(s.Root, s.Root.Name, root)
+	}
+
+	return matches
+}
+
+// hasEntry : Check if a folder contains an entry matching a pattern
+func (m *Matcher) hasEntry(dir string, pattern string) bool {
+	entries, err := m.Dirs.ReadDir(dir)
+	if err != nil {
+		m.recordError(dir, err)
+		return false
+	}
+
+	for _, entry := range entries {
+		matched, err := filepath.Match(pattern, entry.Name())
+		if err != nil {
+			m.recordError(dir, fmt.Errorf("pattern %q: %w", pattern, err))
+			return false
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordError : Record an error of the matching (a missing folder only means it doesn't match)
+func (m *Matcher) recordError(path string, err error) {
+	if m.Errors == nil || errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	m.Errors.Add(path, PhaseMatch, err)
+}
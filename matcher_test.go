@@ -0,0 +1,97 @@
+package inseki
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// courseNode : A course folder, with a syllabus and TP* folders holding Python files
+func courseNode(matchAll bool) Node {
+	return Node{Name: "*", IsDirectory: true, Children: []Node{
+		{Name: "syllabus.md"},
+		{Name: "TP*", IsDirectory: true, MatchAll: matchAll, Children: []Node{{Name: "*.py"}}},
+	}}
+}
+
+func TestMatchNodeWildcardChildren(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"one/syllabus.md":        {},
+		"one/TP1/main.py":        {},
+		"one/TP2/notes.txt":      {},
+		"one/other/main.py":      {},
+		"all/syllabus.md":        {},
+		"all/TP1/a.py":           {},
+		"all/TP2/b.py":           {},
+		"none/syllabus.md":       {},
+		"none/TP1/notes.txt":     {},
+		"none/lab/main.py":       {},
+		"file/syllabus.md":       {},
+		"file/TP1":               {},
+		"missing/TP1/main.py":    {},
+		"nested/syllabus.md":     {},
+		"nested/TP1/sub/main.py": {},
+	})
+
+	tests := []struct {
+		root     string
+		matchAll bool
+		want     bool
+	}{
+		{"one", false, true},
+		{"one", true, false}, // TP2 has no Python file
+		{"all", false, true},
+		{"all", true, true},
+		{"none", false, false},
+		{"none", true, false}, // No folder matching at all
+		{"file", false, false},
+		{"missing", false, false},
+		{"nested", false, false},
+		{"absent", false, false},
+	}
+
+	for _, test := range tests {
+		matcher := NewMatcher(fsys)
+		if got := matcher.MatchNode(courseNode(test.matchAll), test.root); got != test.want {
+			t.Errorf("%s (matchAll %v) = %v, want %v", test.root, test.matchAll, got, test.want)
+		}
+	}
+}
+
+func TestMatchStructureWildcardChildren(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"course/syllabus.md":      {},
+		"course/TP1/main.py":      {},
+		"course/TP2/sub/deep.py":  {},
+		"course/TP3/exercise.py":  {},
+		"lonely/TP1/main.py":      {},
+		"course/TP1/data/data.py": {},
+	})
+
+	structure := Structure{ID: "course.json", Root: courseNode(false)}
+
+	tests := []struct {
+		trigger string
+		root    string
+		matched bool
+	}{
+		{"course/TP1/main.py", "course", true},
+		{"course/TP3/exercise.py", "course", true},
+		{"course/syllabus.md", "course", true},
+		{"lonely/TP1/main.py", "", false},
+		// One folder down from the course, its parent is not a TP* folder
+		{"course/TP1/data/data.py", "", false},
+	}
+
+	for _, test := range tests {
+		matched, root := NewMatcher(fsys).MatchStructure(structure, test.trigger)
+		if matched != test.matched || root != test.root {
+			t.Errorf("%s = %v %q, want %v %q", test.trigger, matched, root, test.matched, test.root)
+		}
+	}
+}
+
+func TestMatchAllHash(t *testing.T) {
+	if courseNode(true).Hash() == courseNode(false).Hash() {
+		t.Error("matchAll doesn't change the hash")
+	}
+}
@@ -0,0 +1,161 @@
+package inseki
+
+// patternToken : A single element of a glob pattern (see filepath.Match)
+// Like filepath.Match, a character is a rune : "?" matches "é", which is two bytes
+type patternToken struct {
+	kind    byte   // 'c' literal char, '?' any char, '*' any sequence, '[' character class
+	literal rune   // For literal chars
+	class   string // For character classes, content between the brackets
+}
+
+// tokenizePattern : Split a glob pattern into tokens
+// Returns false if the pattern is malformed
+func tokenizePattern(pattern string) ([]patternToken, bool) {
+	tokens := make([]patternToken, 0, len(pattern))
+	chars := []rune(pattern)
+
+	for i := 0; i < len(chars); i++ {
+		switch chars[i] {
+		case '*':
+			// Consecutive stars are the same as a single one
+			if len(tokens) > 0 && tokens[len(tokens)-1].kind == '*' {
+				continue
+			}
+			tokens = append(tokens, patternToken{kind: '*'})
+		case '?':
+			tokens = append(tokens, patternToken{kind: '?'})
+		case '[':
+			end := i + 1
+			// A ']' right after '[' (or '[^') is part of the class
+			if end < len(chars) && chars[end] == '^' {
+				end++
+			}
+			if end < len(chars) && chars[end] == ']' {
+				end++
+			}
+			for end < len(chars) && chars[end] != ']' {
+				if chars[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(chars) {
+				return nil, false
+			}
+			tokens = append(tokens, patternToken{kind: '[', class: string(chars[i+1 : end])})
+			i = end
+		case '\\':
+			if i+1 >= len(chars) {
+				return nil, false
+			}
+			i++
+			tokens = append(tokens, patternToken{kind: 'c', literal: chars[i]})
+		default:
+			tokens = append(tokens, patternToken{kind: 'c', literal: chars[i]})
+		}
+	}
+
+	return tokens, true
+}
+
+// classContains : Check if a character class matches a char
+func classContains(class string, c rune) bool {
+	chars := []rune(class)
+
+	negated := false
+	if len(chars) > 0 && chars[0] == '^' {
+		negated = true
+		chars = chars[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(chars); i++ {
+		lo := chars[i]
+		if lo == '\\' && i+1 < len(chars) {
+			i++
+			lo = chars[i]
+		}
+
+		hi := lo
+		if i+2 < len(chars) && chars[i+1] == '-' {
+			hi = chars[i+2]
+			if hi == '\\' && i+3 < len(chars) {
+				hi = chars[i+3]
+				i++
+			}
+			i += 2
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	return matched != negated
+}
+
+// tokenSubsumes : Check if a single-char token of the general pattern covers a single-char token of the specific one
+func tokenSubsumes(general patternToken, specific patternToken) bool {
+	switch general.kind {
+	case '?':
+		return true
+	case 'c':
+		return specific.kind == 'c' && specific.literal == general.literal
+	case '[':
+		if specific.kind == 'c' {
+			return classContains(general.class, specific.literal)
+		}
+		// Without expanding the classes, only identical classes are known to be covered
+		return specific.kind == '[' && specific.class == general.class
+	}
+	return false
+}
+
+// tokensSubsume : Check if every name matched by the specific tokens is matched by the general tokens
+func tokensSubsume(general []patternToken, specific []patternToken) bool {
+	if len(general) == 0 {
+		return len(specific) == 0
+	}
+
+	if general[0].kind == '*' {
+		// The star matches nothing, or it swallows the next token of the specific pattern
+		if tokensSubsume(general[1:], specific) {
+			return true
+		}
+		return len(specific) > 0 && tokensSubsume(general, specific[1:])
+	}
+
+	// Only a star can cover a star
+	if len(specific) == 0 || specific[0].kind == '*' {
+		return false
+	}
+
+	return tokenSubsumes(general[0], specific[0]) && tokensSubsume(general[1:], specific[1:])
+}
+
+/*
+PatternSubsumes
+Check if every name matched by the specific pattern is also matched by the general one
+
+PatternSubsumes("*.c", "main.c") -> true
+PatternSubsumes("main.c", "*.c") -> false
+
+The check is conservative: when it can't be proven (different character classes), it returns false
+*/
+func PatternSubsumes(general string, specific string) bool {
+	if general == specific {
+		return true
+	}
+
+	generalTokens, ok := tokenizePattern(general)
+	if !ok {
+		return false
+	}
+
+	specificTokens, ok := tokenizePattern(specific)
+	if !ok {
+		return false
+	}
+
+	return tokensSubsume(generalTokens, specificTokens)
+}
@@ -0,0 +1,79 @@
+package inseki
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPatternSubsumes(t *testing.T) {
+	tests := []struct {
+		general  string
+		specific string
+		want     bool
+	}{
+		{"*.c", "main.c", true},
+		{"main.c", "*.c", false},
+		{"*.c", "*.c", true},
+		{"*", "anything", true},
+		{"*", "*.go", true},
+		{"*.go", "*", false},
+		{"*_test.go", "main_test.go", true},
+		{"*_test.go", "*.go", false},
+		{"*.go", "*_test.go", true},
+		{"a*b", "a*x*b", true},
+		{"a*x*b", "a*b", false},
+		{"?.c", "a.c", true},
+		{"?.c", "ab.c", false},
+		{"?.c", "*.c", false},
+		{"[abc].c", "a.c", true},
+		{"[abc].c", "d.c", false},
+		{"[a-z].c", "[b-c].c", false},
+		{"[a-z].c", "[a-z].c", true},
+		{"*.C", "main.c", false},
+		{"Makefile", "makefile", false},
+		// A character is a rune, like in filepath.Match
+		{"??.c", "é.c", false},
+		{"?.c", "é.c", true},
+		{"*.c", "café.c", true},
+		{"caf?.c", "café.c", true},
+		{"caf??.c", "café.c", false},
+		{"[é].c", "é.c", true},
+		{"[a-z].c", "é.c", false},
+		{"[à-ÿ].c", "é.c", true},
+		{"[^é].c", "é.c", false},
+		{"é*", "é?", true},
+		{"日本*", "日本語.txt", true},
+		{"日?語*", "日本語.txt", true},
+		{"日??語*", "日本語.txt", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.general+" "+test.specific, func(t *testing.T) {
+			if got := PatternSubsumes(test.general, test.specific); got != test.want {
+				t.Errorf("PatternSubsumes(%q, %q) = %v, want %v", test.general, test.specific, got, test.want)
+			}
+		})
+	}
+}
+
+// Whatever the patterns, a name matched by the specific one has to be matched by the general one when it subsumes it
+func TestPatternSubsumesIsConservative(t *testing.T) {
+	patterns := []string{"*", "*.c", "?.c", "??.c", "???.c", "[a-z].c", "[^a].c", "é.c", "[é].c", "ca?é.c", "*é*", "?", "??", "main.c", "m*.c", "*_test.go", "*.go"}
+	names := []string{"a.c", "é.c", "ab.c", "main.c", "café.c", "caré.c", "é", "日本", "x_test.go", "x.go", "Z.c"}
+
+	for _, general := range patterns {
+		for _, specific := range patterns {
+			if !PatternSubsumes(general, specific) {
+				continue
+			}
+
+			for _, name := range names {
+				specificMatch, _ := filepath.Match(specific, name)
+				generalMatch, _ := filepath.Match(general, name)
+				if specificMatch && !generalMatch {
+					t.Errorf("PatternSubsumes(%q, %q) but only %q matches %q", general, specific, specific, name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package inseki
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval : Minimum time between two progress events, unless Config.ProgressInterval says otherwise
+const DefaultProgressInterval = 200 * time.Millisecond
+
+// Progress : Snapshot of a running scan
+type Progress struct {
+	Phase       Phase  // Current step : import, walk or match
+	Done        bool   // Last event of the scan
+	CurrentPath string // Last file or folder seen
+
+	StructuresAnalysed int
+	DirsVisited        int
+	FilesCounted       int
+	TargetsQueued      int // Files and folders waiting for a matching worker
+	CandidatesChecked  int // (structure, file) pairs checked
+	ProjectsFound      int // Projects confirmed so far, once their root is complete
+	Errors             int
+
+	// Only filled in the last event
+	Walk           WalkStats
+	MemoHits       uint64
+	MemoMisses     uint64
+	DirCacheHits   uint64
+	DirCacheMisses uint64
+
+	Elapsed time.Duration
+}
+
+/*
+ProgressFunc : Receives the progress events of a scan, never concurrently
+
+It runs in a goroutine of its own, so a slow function doesn't slow the scan down :
+the events sent in the meantime are merged, and it only gets the latest one.
+The last event (Done) is always delivered before the scan returns.
+*/
+type ProgressFunc func(progress Progress)
+
+// LogProgress : ProgressFunc logging the counters of the scan once it is done
+func LogProgress(progress Progress) {
+	if !progress.Done {
+		return
+	}
+
+	log.Printf("Number of structures analysed: %d\n", progress.StructuresAnalysed)
+	log.Printf("Number of files analysed: %d\n", progress.Walk.FilesAnalysed)
+
+	if progress.Walk.Skipped() > 0 {
+		log.Printf("Skipped: %d too deep, %d on another filesystem, %d hidden, %d large folders, %d large files\n",
+			progress.Walk.SkippedDepth, progress.Walk.SkippedMount, progress.Walk.SkippedHidden,
+			progress.Walk.SkippedLargeDir, progress.Walk.SkippedLargeFile)
+	}
+
+	log.Printf("Match memo: %d hits, %d misses\n", progress.MemoHits, progress.MemoMisses)
+	log.Printf("Directory cache: %d hits, %d misses\n", progress.DirCacheHits, progress.DirCacheMisses)
+
+	if progress.Errors > 0 {
+		log.Printf("Number of errors: %d\n", progress.Errors)
+	}
+
+	log.Printf("Number of projects found: %d (%s)\n", progress.ProjectsFound, progress.Elapsed.Round(time.Millisecond))
+}
+
+// progressTracker : Counters of a scan, sent to a ProgressFunc at most once per interval
+type progressTracker struct {
+	fn       ProgressFunc
+	interval time.Duration
+	start    time.Time
+
+	structures atomic.Int64
+	dirs       atomic.Int64
+	files      atomic.Int64
+	targets    atomic.Int64
+	candidates atomic.Int64
+	settled    atomic.Int64 // Projects confirmed, once their root is complete
+	errors     func() int
+
+	mu      sync.Mutex
+	phase   Phase
+	current string
+	last    time.Time
+
+	// Latest event not delivered yet, read by the goroutine calling fn
+	sendMu    sync.Mutex
+	events    chan Progress
+	delivered chan struct{}
+	closed    bool // No more events once the last one is sent
+
+	// Set once the matching starts, for the cache counters of the last event
+	matcher *Matcher
+}
+
+func newProgressTracker(fn ProgressFunc, interval time.Duration, report *ErrorReport) *progressTracker {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+
+	t := &progressTracker{
+		fn:       fn,
+		interval: interval,
+		start:    time.Now(),
+		errors:   report.Len,
+	}
+
+	if fn != nil {
+		t.events = make(chan Progress, 1)
+		t.delivered = make(chan struct{})
+
+		go func() {
+			defer close(t.delivered)
+
+			for progress := range t.events {
+				fn(progress)
+			}
+		}()
+	}
+
+	return t
+}
+
+// enter : Start a new phase
+func (t *progressTracker) enter(phase Phase) {
+	t.mu.Lock()
+	t.phase = phase
+	t.mu.Unlock()
+
+	t.emit()
+}
+
+// visit : A file or folder was accepted by the walk
+func (t *progressTracker) visit(path string, isDir bool) {
+	if isDir {
+		t.dirs.Add(1)
+	} else {
+		t.files.Add(1)
+	}
+
+	t.mu.Lock()
+	t.current = path
+	t.mu.Unlock()
+
+	t.emit()
+}
+
+// confirm : Projects were confirmed
+func (t *progressTracker) confirm(count int) {
+	t.settled.Add(int64(count))
+	t.emit()
+}
+
+func (t *progressTracker) snapshot() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Progress{
+		Phase:              t.phase,
+		CurrentPath:        t.current,
+		StructuresAnalysed: int(t.structures.Load()),
+		DirsVisited:        int(t.dirs.Load()),
+		FilesCounted:       int(t.files.Load()),
+		TargetsQueued:      int(t.targets.Load()),
+		CandidatesChecked:  int(t.candidates.Load()),
+		ProjectsFound:      int(t.settled.Load()),
+		Errors:             t.errors(),
+		Elapsed:            time.Since(t.start),
+	}
+}
+
+// emit : Send an event, unless the last one is too recent
+func (t *progressTracker) emit() {
+	if t.fn == nil {
+		return
+	}
+
+	t.mu.Lock()
+	if time.Since(t.last) < t.interval {
+		t.mu.Unlock()
+		return
+	}
+	t.last = time.Now()
+	t.mu.Unlock()
+
+	t.send(t.snapshot())
+}
+
+// finish : Send the last event, whatever the time since the previous one
+func (t *progressTracker) finish(result ScanResult) {
+	if t.fn == nil {
+		return
+	}
+
+	progress := t.snapshot()
+	progress.Done = true
+	if result.Responses != nil {
+		progress.ProjectsFound = result.Total
+	}
+	progress.Walk = result.Walk
+
+	if t.matcher != nil {
+		progress.MemoHits, progress.MemoMisses = t.matcher.Memo.Stats()
+		progress.DirCacheHits, progress.DirCacheMisses = t.matcher.Dirs.Stats()
+	}
+
+	t.send(progress)
+
+	// Wait for the last event to be delivered
+	t.sendMu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.events)
+	}
+	t.sendMu.Unlock()
+
+	<-t.delivered
+}
+
+// send : Hand an event to the goroutine calling the ProgressFunc, replacing the one it didn't take yet
+func (t *progressTracker) send(progress Progress) {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case <-t.events:
+	default:
+	}
+
+	t.events <- progress
+}
@@ -0,0 +1,157 @@
+package inseki
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProgressThrottling(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		events   int // Without the last one
+	}{
+		{"one per interval", time.Hour, 1},
+		{"every event", time.Nanosecond, 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received []Progress
+
+			// A callback waiting for each event to be taken, so none is merged
+			taken := make(chan struct{})
+			tracker := newProgressTracker(func(progress Progress) {
+				received = append(received, progress)
+				if !progress.Done {
+					taken <- struct{}{}
+				}
+			}, test.interval, NewErrorReport(BestEffort))
+
+			for i := 0; i < 10; i++ {
+				time.Sleep(time.Millisecond)
+				tracker.visit("dir", true)
+
+				select {
+				case <-taken:
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+			tracker.finish(ScanResult{})
+
+			if len(received) != test.events+1 || !received[len(received)-1].Done {
+				t.Fatalf("%d events, want %d and the last one", len(received), test.events)
+			}
+			if last := received[len(received)-1]; last.DirsVisited != 10 {
+				t.Errorf("last event with %d folders, want 10", last.DirsVisited)
+			}
+		})
+	}
+}
+
+func TestProgressSlowCallback(t *testing.T) {
+	var (
+		received []Progress
+		running  atomic.Bool
+		overlap  atomic.Bool
+	)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tracker := newProgressTracker(func(progress Progress) {
+		if !running.CompareAndSwap(false, true) {
+			overlap.Store(true)
+		}
+		defer running.Store(false)
+
+		// The first event is stuck while the scan goes on
+		if len(received) == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, progress)
+	}, time.Nanosecond, NewErrorReport(BestEffort))
+
+	tracker.visit("file", false)
+	<-started
+
+	// The scan never waits for the callback
+	start := time.Now()
+	for i := 1; i < 1000; i++ {
+		tracker.visit("file", false)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the scan waited for the callback (%s)", elapsed)
+	}
+
+	close(release)
+	tracker.finish(ScanResult{})
+
+	if overlap.Load() {
+		t.Error("the callback ran concurrently")
+	}
+
+	// The events sent while the callback was busy are merged into the latest one
+	if len(received) < 2 || len(received) > 3 {
+		t.Fatalf("%d events, want the first, at most one merged, and the last", len(received))
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i].FilesCounted < received[i-1].FilesCounted {
+			t.Errorf("event %d goes back from %d to %d files", i, received[i-1].FilesCounted, received[i].FilesCounted)
+		}
+	}
+	if last := received[len(received)-1]; !last.Done || last.FilesCounted != 1000 {
+		t.Errorf("last event %+v, want Done with 1000 files", last)
+	}
+}
+
+func TestScanRootsProgress(t *testing.T) {
+	for run := 0; run < 10; run++ {
+		var (
+			mu       sync.Mutex
+			received []Progress
+		)
+
+		config := scanTestConfig(t)
+		config.Walk.Workers = 4
+		config.ProgressInterval = time.Nanosecond
+		config.OnProgress = func(progress Progress) {
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			received = append(received, progress)
+			mu.Unlock()
+		}
+
+		result := scanTest(t, config)
+
+		// The last event is delivered before the scan returns, and only once
+		mu.Lock()
+		events := append([]Progress(nil), received...)
+		mu.Unlock()
+
+		if len(events) == 0 || !events[len(events)-1].Done {
+			t.Fatalf("the last event was not delivered before the scan returned")
+		}
+		for _, event := range events[:len(events)-1] {
+			if event.Done {
+				t.Fatalf("Done sent before the last event")
+			}
+		}
+
+		last := events[len(events)-1]
+		if last.ProjectsFound != result.Total || last.Walk != result.Walk || last.StructuresAnalysed != 2 {
+			t.Errorf("last event %+v, want %d projects", last, result.Total)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		if len(received) != len(events) {
+			t.Errorf("%d events delivered after the scan returned", len(received)-len(events))
+		}
+		mu.Unlock()
+	}
+
+}
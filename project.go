@@ -0,0 +1,142 @@
+package inseki
+
+import "sort"
+
+// Project : Everything found at a root, whatever the number of structures and trigger files
+type Project struct {
+	Root     string   `json:"root"`
+	ScanRoot string   `json:"scanRoot"`         // Scanned folder the project was found in
+	Parent   string   `json:"parent,omitempty"` // Root of the closest enclosing project, "" if there is none
+	Nested   []string `json:"nested,omitempty"` // Roots of the projects directly nested in this one
+
+	Structures []ProjectStructure `json:"structures"`
+
+	// Other structures matching the same root, ranked, when only the best one is kept (Config.Exclusive)
+	Alternatives []Structure `json:"alternatives,omitempty"`
+
+	Stats    *ProjectStats `json:"stats,omitempty"`    // Only with Config.ProjectStats
+	Metadata *Metadata     `json:"metadata,omitempty"` // Only with Config.Metadata
+	Git      *GitStatus    `json:"git,omitempty"`      // Only with Config.Git, nil outside of a git work tree
+}
+
+// ProjectStructure : A structure matching a project
+type ProjectStructure struct {
+	Structure Structure   `json:"structure"`
+	Trigger   string      `json:"trigger"` // File or folder that led to the project
+	Matches   []NodeMatch `json:"matches"` // Files and folders satisfying each node of the structure
+}
+
+// Labels : IDs of the structures matching the project
+func (p Project) Labels() []string {
+	labels := make([]string, 0, len(p.Structures))
+	for _, structure := range p.Structures {
+		labels = append(labels, structure.Structure.ID)
+	}
+	return labels
+}
+
+// Triggers : Files or folders that led to the project, one per structure
+func (p Project) Triggers() []string {
+	triggers := make([]string, 0, len(p.Structures))
+	for _, structure := range p.Structures {
+		triggers = append(triggers, structure.Trigger)
+	}
+	return triggers
+}
+
+// GroupProjects : Gather the responses of each root in a Project, in the order of their first response
+// The structures of a project are sorted by ID, the files satisfying each of them are read from fsys (the OS if nil)
+func GroupProjects(fsys FileSystem, responses []Response) []Project {
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+
+	projects := groupProjects(responses)
+
+	// Projects often share folders (nested projects)
+	collectMatches(NewMatcher(fsys), projects)
+
+	return projects
+}
+
+// groupProjects : GroupProjects, without the files satisfying the structures (see collectMatches)
+func groupProjects(responses []Response) []Project {
+	projects := make([]Project, 0)
+	index := make(map[string]int) // map[root] = position in projects
+
+	for _, response := range responses {
+		i, ok := index[response.Root]
+		if !ok {
+			i = len(projects)
+			index[response.Root] = i
+			projects = append(projects, Project{
+				Root:     response.Root,
+				ScanRoot: response.ScanRoot,
+				Parent:   response.Parent,
+				Nested:   response.Nested,
+			})
+		}
+
+		projects[i].Structures = append(projects[i].Structures, ProjectStructure{
+			Structure: response.Structure,
+			Trigger:   response.Filepath,
+		})
+		projects[i].Alternatives = append(projects[i].Alternatives, response.Alternatives...)
+	}
+
+	for _, project := range projects {
+		sort.SliceStable(project.Structures, func(i, j int) bool {
+			return project.Structures[i].Structure.ID < project.Structures[j].Structure.ID
+		})
+	}
+
+	return projects
+}
+
+// collectMatches : Fill the files and folders satisfying each structure of the projects, read through matcher
+func collectMatches(matcher *Matcher, projects []Project) {
+	for _, project := range projects {
+		for i, structure := range project.Structures {
+			project.Structures[i].Matches = matcher.Collect(structure.Structure, project.Root)
+		}
+	}
+}
+
+// Responses : The project as one response per structure, like Process gives them
+func (p Project) Responses() []Response {
+	responses := make([]Response, 0, len(p.Structures))
+
+	for _, structure := range p.Structures {
+		responses = append(responses, Response{
+			Filepath:     structure.Trigger,
+			Root:         p.Root,
+			ScanRoot:     p.ScanRoot,
+			Structure:    structure.Structure,
+			Parent:       p.Parent,
+			Nested:       append([]string(nil), p.Nested...),
+			Alternatives: p.Alternatives, // Only with Config.Exclusive, where a project has a single structure
+		})
+	}
+
+	return responses
+}
+
+// ProjectIndex : map[structure ID] = roots of the projects matching the structure, sorted
+type ProjectIndex map[string][]string
+
+// IndexProjects : Reverse index from the structures to the projects
+func IndexProjects(projects []Project) ProjectIndex {
+	index := make(ProjectIndex)
+
+	for _, project := range projects {
+		for _, label := range project.Labels() {
+			index[label] = append(index[label], project.Root)
+		}
+	}
+
+	for _, roots := range index {
+		sort.Strings(roots)
+	}
+
+	return index
+}
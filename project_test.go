@@ -0,0 +1,103 @@
+package inseki
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGroupProjects(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"p/main.c": {},
+		"p/util.c": {},
+		"p/go.mod": {},
+		"q/x.c":    {},
+	})
+
+	structure := func(id string, child string) Structure {
+		return Structure{ID: id, Root: Node{Name: "*", IsDirectory: true, Children: []Node{{Name: child}}}}
+	}
+
+	projects := GroupProjects(fsys, []Response{
+		{Root: "q", Filepath: "q/x.c", Structure: structure("c.json", "*.c")},
+		{Root: "p", Filepath: "p/go.mod", Structure: structure("go.json", "go.mod")},
+		{Root: "p", Filepath: "p/main.c", Structure: structure("c.json", "*.c")},
+	})
+
+	got := make([]string, 0)
+	for _, project := range projects {
+		for _, structure := range project.Structures {
+			got = append(got, fmt.Sprintf("%s %s %s %v", project.Root, structure.Structure.ID, structure.Trigger, structure.Matches))
+		}
+	}
+
+	// Roots in the order of their first response, structures sorted by ID
+	want := []string{
+		"q c.json q/x.c [{* [q]} {*/*.c [q/x.c]}]",
+		"p c.json p/main.c [{* [p]} {*/*.c [p/main.c p/util.c]}]",
+		"p go.json p/go.mod [{* [p]} {*/go.mod [p/go.mod]}]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("projects %q, want %q", got, want)
+	}
+}
+
+// countingFileSystem : Counts the listings of each folder
+type countingFileSystem struct {
+	FileSystem
+
+	mu    *sync.Mutex
+	reads map[string]int
+}
+
+func (f countingFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	f.mu.Lock()
+	f.reads[name]++
+	f.mu.Unlock()
+
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestScanRootsProjectMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		results ResultOptions
+		want    []string
+	}{
+		{"every project", ResultOptions{}, []string{"data/a", "data/a-b", "data/a/sub", "data/b", "data/b/cgo", "data/big"}},
+		{"page", ResultOptions{Offset: 1, Limit: 2}, []string{"data/a-b", "data/a/sub"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := countingFileSystem{FileSystem: FromFS(scanTestFiles()), mu: &sync.Mutex{}, reads: make(map[string]int)}
+
+			config := scanTestConfig(t)
+			config.FS = fsys
+			config.Results = test.results
+
+			result := scanTest(t, config)
+			if got := projectRoots(result.Projects); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("projects %q, want %q", got, test.want)
+			}
+
+			for _, project := range result.Projects {
+				for _, structure := range project.Structures {
+					if len(structure.Matches) == 0 {
+						t.Errorf("no match collected for %s in %s", structure.Structure.ID, project.Root)
+					}
+				}
+			}
+
+			// Once by the walk and once by the matching, the matches reuse the listings of the scan
+			for dir, reads := range fsys.reads {
+				if reads > 2 {
+					t.Errorf("%s read %d times", dir, reads)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package inseki
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -9,14 +11,15 @@ import (
 )
 
 // ReadInsekiIgnore Read the .insekiignore file
+// Lines follow the gitignore syntax and are relative to the scanned folder (see ParseIgnoreRules)
 func ReadInsekiIgnore(config Config) (error, []string) {
-	insekiIgnorePath := filepath.Join(config.InsekiPath, ".insekiignore")
+	insekiIgnorePath := filepath.Join(config.InsekiPath, InsekiIgnoreFile)
 
 	// Read the .insekiignore file
-	insekiIgnore, err := os.ReadFile(insekiIgnorePath)
+	insekiIgnore, err := config.configFileSystem().ReadFile(insekiIgnorePath)
 	if err != nil {
 		// If the file does not exist, return an empty slice
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, []string{}
 		}
 
@@ -55,38 +58,179 @@ func TranslateDir(path string) string {
 	return path
 }
 
+// WalkStats : Counters of ExploreFolder
+type WalkStats struct {
+	FilesAnalysed int `json:"filesAnalysed"`
+
+	// Entries skipped because of the WalkOptions limits
+	SkippedDepth     int `json:"skippedDepth"`     // Folders at MaxDepth, whose content is not explored
+	SkippedMount     int `json:"skippedMount"`     // Folders on another filesystem (OneFileSystem)
+	SkippedHidden    int `json:"skippedHidden"`    // Names starting with a dot (SkipHidden)
+	SkippedLargeDir  int `json:"skippedLargeDir"`  // Folders with more than MaxDirEntries entries
+	SkippedLargeFile int `json:"skippedLargeFile"` // Files bigger than MaxFileSize
+}
+
+// Add : Add the counters of another walk
+func (s *WalkStats) Add(other WalkStats) {
+	s.FilesAnalysed += other.FilesAnalysed
+	s.SkippedDepth += other.SkippedDepth
+	s.SkippedMount += other.SkippedMount
+	s.SkippedHidden += other.SkippedHidden
+	s.SkippedLargeDir += other.SkippedLargeDir
+	s.SkippedLargeFile += other.SkippedLargeFile
+}
+
+// Skipped : Number of entries skipped because of the limits
+func (s WalkStats) Skipped() int {
+	return s.SkippedDepth + s.SkippedMount + s.SkippedHidden + s.SkippedLargeDir + s.SkippedLargeFile
+}
+
+// errTooManyEntries : Replaces the content of a folder bigger than WalkOptions.MaxDirEntries
+var errTooManyEntries = errors.New("too many entries")
+
+// limitedFileSystem : Refuse to list folders with too many entries, listing them stops right after the limit
+type limitedFileSystem struct {
+	FileSystem
+	maxEntries int
+}
+
+func (l limitedFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := readDirLimit(l.FileSystem, name, l.maxEntries+1)
+	if err == nil && len(entries) > l.maxEntries {
+		return nil, errTooManyEntries
+	}
+	return entries, err
+}
+
 // ExploreFolder Analyze for structures
-func ExploreFolder(path string, insekiIgnore []string, callback func(path string, info os.FileInfo) error, numberFilesAnalysed *int) error {
+// insekiIgnore holds gitignore-like rules, .insekiignore files met in the scanned folders apply to their own subtree
+// The callback is called once per entry, never concurrently, even with several workers (see WalkOptions)
+// info only reads the size, mode and times of the entry when they are asked, the walk itself doesn't stat the entries
+// A folder is given to the callback before it is read, if it then can't be read the error goes to report
+// The walk stops as soon as ctx is done, and returns ctx.Err()
+// The limits of options are enforced, stats counts what was analysed and skipped
+// Errors are recorded in report, which decides if the walk goes on (a nil report stops at the first one)
+func ExploreFolder(ctx context.Context, fsys FileSystem, path string, insekiIgnore []string, options WalkOptions, callback func(path string, info os.FileInfo) error, stats *WalkStats, report *ErrorReport) error {
+	return exploreFolder(ctx, fsys, path, insekiIgnore, options, callback, nil, stats, report)
+}
+
+// exploreFolder : ExploreFolder, leave is called once each folder met by the walk is done (see walkFileSystem)
+func exploreFolder(ctx context.Context, fsys FileSystem, path string, insekiIgnore []string, options WalkOptions, callback func(path string, info os.FileInfo) error, leave func(dir string), stats *WalkStats, report *ErrorReport) error {
+
+	// Translate the path (~ only makes sense on the OS)
+	if onOS(fsys) {
+		path = TranslateDir(path)
+	}
+
+	root := filepath.Clean(path)
+
+	// Without its root, there is nothing to scan
+	if _, err := statRoot(fsys, root); err != nil {
+		return err
+	}
+
+	ignore := NewIgnoreMatcher(fsys, root, insekiIgnore, options.GitIgnore)
+
+	return exploreTree(ctx, fsys, root, root, ignore, options, callback, leave, stats, report)
+}
+
+// exploreTree : Walk root like a part of a walk started at anchor, an ancestor of root (or root itself)
+// ignore must already hold the rules of the folders from anchor to the parent of root, MaxDepth and OneFileSystem count from anchor
+func exploreTree(ctx context.Context, fsys FileSystem, anchor string, root string, ignore *IgnoreMatcher, options WalkOptions, callback func(path string, info os.FileInfo) error, leave func(dir string), stats *WalkStats, report *ErrorReport) error {
+
+	// The folder is read only once its own entry is accepted, so the matching reads it normally
+	walkFS := fsys
+	if options.MaxDirEntries > 0 {
+		walkFS = limitedFileSystem{FileSystem: fsys, maxEntries: options.MaxDirEntries}
+	}
 
-	// Translate the path
-	path = TranslateDir(path)
+	// Device of the root, to stay on the same filesystem
+	var rootDevice uint64
+	hasRootDevice := false
+	if options.OneFileSystem {
+		if info, err := statRoot(fsys, anchor); err == nil {
+			rootDevice, hasRootDevice = deviceID(info)
+		}
+	}
+
+	return walkFileSystem(walkFS, root, options.Workers, options.Deterministic, func(path string, info os.FileInfo, err error) error {
+		// Checked before each entry, so the walk stops promptly
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 
-			// If the error is "operation not permitted", we can ignore it
-			if os.IsPermission(err) {
+			// The folder has too many entries, its content is skipped
+			if errors.Is(err, errTooManyEntries) {
+				stats.SkippedLargeDir++
 				return nil
 			}
 
-			fmt.Println("Error: ", err)
-			return err
+			// Unreadable entries (permissions, corrupted archives, ...) are recorded, the policy decides if the walk goes on
+			return report.Add(path, PhaseWalk, err)
 		}
 
-		if !info.IsDir() {
-			*numberFilesAnalysed++
+		// ----------------------------- Limits -----------------------------
+
+		skip := func(counter *int) error {
+			*counter++
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		// Check if the file or folder name is in the .insekiIgnore
-		for _, ignore := range insekiIgnore {
-			if filepath.Base(path) == ignore {
-				if info.IsDir() {
-					return filepath.SkipDir
+		if path != root {
+			if options.SkipHidden && strings.HasPrefix(info.Name(), ".") {
+				return skip(&stats.SkippedHidden)
+			}
+
+			if hasRootDevice && info.IsDir() {
+				if device, ok := deviceID(info); ok && device != rootDevice {
+					return skip(&stats.SkippedMount)
 				}
-				return nil
 			}
+
+			if options.MaxFileSize > 0 && !info.IsDir() && info.Size() > options.MaxFileSize {
+				return skip(&stats.SkippedLargeFile)
+			}
+		}
+
+		if !info.IsDir() {
+			stats.FilesAnalysed++
+		}
+
+		// Check if the file or folder is ignored by the .insekiignore (and .gitignore) files
+		if ignore.Ignored(path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// The ignore files of a folder apply to its content
+		if info.IsDir() {
+			ignore.LoadDir(path)
 		}
 
-		return callback(path, info)
-	})
+		err = callback(path, info)
+
+		// The content of a folder at the maximum depth is not even read
+		if err == nil && info.IsDir() && options.MaxDepth > 0 && walkDepth(anchor, path) >= options.MaxDepth {
+			stats.SkippedDepth++
+			return filepath.SkipDir
+		}
+
+		return err
+	}, leave)
+}
+
+// walkDepth : Number of folders between root and path (1 for a direct child)
+func walkDepth(root string, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
 }
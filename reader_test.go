@@ -0,0 +1,85 @@
+package inseki
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExploreFolderLimits(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"root/a.c":          {Data: []byte("a\n")},
+		"root/big.c":        {Data: bytes.Repeat([]byte("x"), 100)},
+		"root/.dot.c":       {Data: []byte("dot\n")},
+		"root/.hidden/h.c":  {Data: []byte("h\n")},
+		"root/d1/x.c":       {Data: []byte("x\n")},
+		"root/d1/d2/y.c":    {Data: []byte("y\n")},
+		"root/many/1.c":     {Data: []byte("1\n")},
+		"root/many/2.c":     {Data: []byte("2\n")},
+		"root/many/3.c":     {Data: []byte("3\n")},
+		"root/many/4.c":     {Data: []byte("4\n")},
+		"root/many/5.c":     {Data: []byte("5\n")},
+		"root/many/6.c":     {Data: []byte("6\n")},
+		"root/many/7.c":     {Data: []byte("7\n")},
+		"root/many/8.c":     {Data: []byte("8\n")},
+		"root/ignored/i.c":  {Data: []byte("i\n")},
+		"root/d1/ignored.c": {Data: []byte("i\n")},
+	})
+
+	everything := []string{"root", "root/.dot.c", "root/.hidden", "root/.hidden/h.c", "root/a.c", "root/big.c", "root/d1", "root/d1/d2", "root/d1/d2/y.c", "root/d1/x.c", "root/many", "root/many/1.c", "root/many/2.c", "root/many/3.c", "root/many/4.c", "root/many/5.c", "root/many/6.c", "root/many/7.c", "root/many/8.c"}
+
+	tests := []struct {
+		name    string
+		options WalkOptions
+		visited []string
+		stats   WalkStats
+	}{
+		{"no limit", WalkOptions{}, everything, WalkStats{FilesAnalysed: 15}},
+		{"depth 1", WalkOptions{MaxDepth: 1},
+			[]string{"root", "root/.dot.c", "root/.hidden", "root/a.c", "root/big.c", "root/d1", "root/many"},
+			WalkStats{FilesAnalysed: 3, SkippedDepth: 3}},
+		{"depth 2", WalkOptions{MaxDepth: 2},
+			[]string{"root", "root/.dot.c", "root/.hidden", "root/.hidden/h.c", "root/a.c", "root/big.c", "root/d1", "root/d1/d2", "root/d1/x.c", "root/many", "root/many/1.c", "root/many/2.c", "root/many/3.c", "root/many/4.c", "root/many/5.c", "root/many/6.c", "root/many/7.c", "root/many/8.c"},
+			WalkStats{FilesAnalysed: 14, SkippedDepth: 1}},
+		{"hidden", WalkOptions{SkipHidden: true},
+			[]string{"root", "root/a.c", "root/big.c", "root/d1", "root/d1/d2", "root/d1/d2/y.c", "root/d1/x.c", "root/many", "root/many/1.c", "root/many/2.c", "root/many/3.c", "root/many/4.c", "root/many/5.c", "root/many/6.c", "root/many/7.c", "root/many/8.c"},
+			WalkStats{FilesAnalysed: 13, SkippedHidden: 2}},
+		{"large folders", WalkOptions{MaxDirEntries: 7},
+			[]string{"root", "root/.dot.c", "root/.hidden", "root/.hidden/h.c", "root/a.c", "root/big.c", "root/d1", "root/d1/d2", "root/d1/d2/y.c", "root/d1/x.c", "root/many"},
+			WalkStats{FilesAnalysed: 7, SkippedLargeDir: 1}},
+		{"large files", WalkOptions{MaxFileSize: 10},
+			[]string{"root", "root/.dot.c", "root/.hidden", "root/.hidden/h.c", "root/a.c", "root/d1", "root/d1/d2", "root/d1/d2/y.c", "root/d1/x.c", "root/many", "root/many/1.c", "root/many/2.c", "root/many/3.c", "root/many/4.c", "root/many/5.c", "root/many/6.c", "root/many/7.c", "root/many/8.c"},
+			WalkStats{FilesAnalysed: 14, SkippedLargeFile: 1}},
+		{"one filesystem", WalkOptions{OneFileSystem: true}, everything, WalkStats{FilesAnalysed: 15}},
+		{"every limit, parallel", WalkOptions{Workers: 4, MaxDepth: 2, SkipHidden: true, MaxFileSize: 10},
+			[]string{"root", "root/a.c", "root/d1", "root/d1/d2", "root/d1/x.c", "root/many", "root/many/1.c", "root/many/2.c", "root/many/3.c", "root/many/4.c", "root/many/5.c", "root/many/6.c", "root/many/7.c", "root/many/8.c"},
+			WalkStats{FilesAnalysed: 11, SkippedDepth: 1, SkippedHidden: 2, SkippedLargeFile: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stats WalkStats
+			visited := make([]string, 0)
+
+			err := ExploreFolder(context.Background(), fsys, "root", []string{"ignored/", "ignored.c"}, test.options, func(path string, info os.FileInfo) error {
+				visited = append(visited, path)
+				return nil
+			}, &stats, NewErrorReport(BestEffort))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(visited)
+			if !reflect.DeepEqual(visited, test.visited) {
+				t.Errorf("visited %q, want %q", visited, test.visited)
+			}
+			if stats != test.stats {
+				t.Errorf("stats %+v, want %+v", stats, test.stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package inseki
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ErrorPolicy : What the scan does when it meets an error
+type ErrorPolicy string
+
+const (
+	// BestEffort : Record the error, skip what it concerns and go on (default)
+	BestEffort ErrorPolicy = "best-effort"
+	// FailFast : Stop the scan at the first error
+	FailFast ErrorPolicy = "fail-fast"
+)
+
+// IsValid : Check if the policy is known (an empty policy means BestEffort)
+func (p ErrorPolicy) IsValid() bool {
+	switch p {
+	case "", BestEffort, FailFast:
+		return true
+	}
+	return false
+}
+
+// Phase : Step of the scan where an error happened
+type Phase string
+
+const (
+	PhaseImport Phase = "import" // Reading the structures
+	PhaseRoots  Phase = "roots"  // Checking the folders to scan
+	PhaseWalk   Phase = "walk"   // Exploring the scanned folder
+	PhaseMatch  Phase = "match"  // Checking a structure around a file
+
+	PhaseMetadata Phase = "metadata" // Reading the manifests or the git status of a project
+)
+
+// ScanError : An error met during the scan
+type ScanError struct {
+	Path  string
+	Phase Phase
+	Err   error
+}
+
+func (e ScanError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Phase, e.Path, e.Err)
+}
+
+func (e ScanError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON : The error is written as its message
+func (e ScanError) MarshalJSON() ([]byte, error) {
+	message := ""
+	if e.Err != nil {
+		message = e.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Path  string `json:"path"`
+		Phase Phase  `json:"phase"`
+		Error string `json:"error"`
+	}{e.Path, e.Phase, message})
+}
+
+// ErrorReport : Concurrency-safe list of the errors of a scan
+type ErrorReport struct {
+	policy ErrorPolicy
+
+	mu     sync.Mutex
+	errors []ScanError
+	seen   map[string]bool
+	fatal  error
+}
+
+// NewErrorReport : Create an empty report following a policy
+func NewErrorReport(policy ErrorPolicy) *ErrorReport {
+	return &ErrorReport{
+		policy: policy,
+		seen:   make(map[string]bool),
+	}
+}
+
+// Add : Record an error (only once for the same path, phase and message)
+// Returns the error if the scan has to stop, nil if it can go on
+// A nil report records nothing and always stops, like a fail-fast one
+func (r *ErrorReport) Add(path string, phase Phase, err error) error {
+	scanError := ScanError{Path: path, Phase: phase, Err: err}
+
+	if r == nil {
+		return scanError
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := scanError.Error()
+	if !r.seen[key] {
+		r.seen[key] = true
+		r.errors = append(r.errors, scanError)
+	}
+
+	if r.policy != FailFast {
+		return nil
+	}
+
+	if r.fatal == nil {
+		r.fatal = scanError
+	}
+	return scanError
+}
+
+// Note : Record something the scan skipped on purpose, that never stops it whatever the policy
+func (r *ErrorReport) Note(path string, phase Phase, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scanError := ScanError{Path: path, Phase: phase, Err: err}
+
+	key := scanError.Error()
+	if !r.seen[key] {
+		r.seen[key] = true
+		r.errors = append(r.errors, scanError)
+	}
+}
+
+// Errors : Errors recorded so far
+func (r *ErrorReport) Errors() []ScanError {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]ScanError(nil), r.errors...)
+}
+
+// Len : Number of errors recorded so far
+func (r *ErrorReport) Len() int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.errors)
+}
+
+// Fatal : First error that stopped the scan (fail-fast), nil otherwise
+func (r *ErrorReport) Fatal() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.fatal
+}
@@ -0,0 +1,128 @@
+package inseki
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestErrorReport(t *testing.T) {
+	errDenied := errors.New("permission denied")
+
+	tests := []struct {
+		name   string
+		policy ErrorPolicy
+		notes  int
+		adds   int
+		stop   bool
+		errors int
+	}{
+		{"default policy", "", 0, 2, false, 1},
+		{"best effort", BestEffort, 0, 2, false, 1},
+		{"fail fast", FailFast, 0, 2, true, 1},
+		{"notes never stop", FailFast, 2, 0, false, 1},
+		{"notes then errors", FailFast, 1, 1, true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewErrorReport(test.policy)
+
+			for i := 0; i < test.notes; i++ {
+				report.Note("data/x", PhaseWalk, errDenied)
+			}
+
+			// The same error is only recorded once
+			var stop error
+			for i := 0; i < test.adds; i++ {
+				stop = report.Add("data/x", PhaseWalk, errDenied)
+			}
+
+			if (stop != nil) != test.stop || (report.Fatal() != nil) != test.stop {
+				t.Errorf("Add = %v, Fatal = %v, want a stop %v", stop, report.Fatal(), test.stop)
+			}
+			if stop != nil && !errors.Is(stop, errDenied) {
+				t.Errorf("stopped by %v, want %v", stop, errDenied)
+			}
+			if report.Len() != test.errors || len(report.Errors()) != test.errors {
+				t.Errorf("%d errors, want %d", report.Len(), test.errors)
+			}
+		})
+	}
+
+	// Without a report, every error stops
+	var report *ErrorReport
+	if err := report.Add("data/x", PhaseWalk, errDenied); !errors.Is(err, errDenied) || report.Len() != 0 {
+		t.Errorf("nil report : %v", err)
+	}
+}
+
+// failingFileSystem : A FileSystem that can't read some folders
+type failingFileSystem struct {
+	FileSystem
+	failing map[string]bool
+}
+
+func (f failingFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	if f.failing[name] {
+		return nil, os.ErrPermission
+	}
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestScanRootsErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ErrorPolicy
+		fails    bool
+		projects []string // Projects that can be found
+		all      bool     // Every one of them is found
+	}{
+		{"best effort", BestEffort, false, []string{"data/a", "data/z"}, true},
+		// The walk stops at data/m, data/a may be confirmed before
+		{"fail fast", FailFast, true, []string{"data/a"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := scanTestConfig(t)
+			config.FS = failingFileSystem{
+				FileSystem: FromFS(fstest.MapFS{
+					"data/a/main.c":   {Data: []byte("main\n")},
+					"data/m/locked.c": {Data: []byte("locked\n")},
+					"data/z/late.c":   {Data: []byte("late\n")},
+				}),
+				failing: map[string]bool{"data/m": true},
+			}
+			config.Walk.Workers = 1
+			config.ErrorPolicy = test.policy
+
+			err, ignore := ReadInsekiIgnore(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err, result := ScanRoots(context.Background(), []string{"data"}, config, ignore)
+			if (err != nil) != test.fails || (err != nil && !errors.Is(err, os.ErrPermission)) {
+				t.Errorf("error %v, want a failure %v", err, test.fails)
+			}
+
+			if len(result.Errors) != 1 || result.Errors[0].Path != "data/m" || result.Errors[0].Phase != PhaseWalk {
+				t.Errorf("errors %v, want the walk of data/m", result.Errors)
+			}
+			got := projectRoots(result.Projects)
+			if test.all && !reflect.DeepEqual(got, test.projects) {
+				t.Errorf("projects %q, want %q", got, test.projects)
+			}
+			for _, root := range got {
+				if !slices.Contains(test.projects, root) {
+					t.Errorf("project %s found after the error", root)
+				}
+			}
+		})
+	}
+}
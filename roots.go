@@ -0,0 +1,107 @@
+package inseki
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scanRoot : A folder to scan, with the resolved path used to detect overlaps
+type scanRoot struct {
+	path     string // Path given to the walk, and shown in the results (a symbolic link is followed by the walk)
+	resolved string // Absolute path, without symbolic links
+}
+
+/*
+normalizeRoots : Clean the roots and remove the ones that are inside another root (or the same one)
+Missing roots are recorded in report and left out, the others are still scanned (unless the policy says otherwise)
+The roots left out because of another one are noted in report
+An error is returned when the scan has to stop, or when no root is left
+*/
+func normalizeRoots(fsys FileSystem, paths []string, report *ErrorReport) (error, []string) {
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+
+	roots := make([]scanRoot, 0, len(paths))
+	var missing error
+
+	for _, path := range paths {
+		root := scanRoot{path: filepath.Clean(path)}
+
+		if onOS(fsys) {
+			root.path = filepath.Clean(TranslateDir(path))
+
+			// Roots can be symlinked into each other
+			root.resolved = root.path
+			if abs, err := filepath.Abs(root.path); err == nil {
+				root.resolved = abs
+			}
+			if resolved, err := filepath.EvalSymlinks(root.resolved); err == nil {
+				root.resolved = resolved
+			}
+		} else {
+			root.resolved = root.path
+		}
+
+		if _, err := statRoot(fsys, root.path); err != nil {
+			missing = err
+			if err := report.Add(root.path, PhaseRoots, err); err != nil {
+				return err, nil
+			}
+			continue
+		}
+
+		roots = append(roots, root)
+	}
+
+	// Outer roots first, so the inner ones are compared to them (the given order breaks ties)
+	sort.SliceStable(roots, func(i, j int) bool {
+		return len(roots[i].resolved) < len(roots[j].resolved)
+	})
+
+	kept := make([]scanRoot, 0, len(roots))
+
+	for _, root := range roots {
+		inside := false
+
+		for _, other := range kept {
+			if isWithin(other.resolved, root.resolved) {
+				report.Note(root.path, PhaseRoots, fmt.Errorf("already scanned with %s", other.path))
+				inside = true
+				break
+			}
+		}
+
+		if !inside {
+			kept = append(kept, root)
+		}
+	}
+
+	// Nothing to scan
+	if len(kept) == 0 && missing != nil {
+		return missing, nil
+	}
+
+	results := make([]string, 0, len(kept))
+	for _, root := range kept {
+		results = append(results, root.path)
+	}
+
+	return nil, results
+}
+
+// isWithin : Check if path is parent, or inside it
+func isWithin(parent string, path string) bool {
+	if parent == path {
+		return true
+	}
+
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
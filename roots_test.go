@@ -0,0 +1,127 @@
+package inseki
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNormalizeRoots(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"data/a/main.c":  {},
+		"data/a-b/x.c":   {},
+		"other/y.c":      {},
+		"data/a/sub/z.c": {},
+	})
+
+	tests := []struct {
+		name   string
+		policy ErrorPolicy
+		paths  []string
+		fails  bool
+		want   []string
+		errors int // Missing roots and roots left out
+	}{
+		{"one root", "", []string{"data"}, false, []string{"data"}, 0},
+		{"cleaned", "", []string{"data/a/../a-b/"}, false, []string{"data/a-b"}, 0},
+		{"disjoint, given order", "", []string{"other", "data/a", "data/a-b"}, false, []string{"other", "data/a", "data/a-b"}, 0},
+		{"inner root left out", "", []string{"data/a/sub", "data"}, false, []string{"data"}, 1},
+		{"same root twice", "", []string{"data/a", "data/a/"}, false, []string{"data/a"}, 1},
+		{"prefix is not a parent", "", []string{"data/a", "data/a-b"}, false, []string{"data/a", "data/a-b"}, 0},
+		{"missing root skipped", BestEffort, []string{"missing", "data"}, false, []string{"data"}, 1},
+		{"missing root stops", FailFast, []string{"missing", "data"}, true, nil, 1},
+		{"every root missing", BestEffort, []string{"missing"}, true, nil, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewErrorReport(test.policy)
+
+			err, roots := normalizeRoots(fsys, test.paths, report)
+			if (err != nil) != test.fails {
+				t.Fatalf("error %v, want a failure %v", err, test.fails)
+			}
+			if !reflect.DeepEqual(roots, test.want) {
+				t.Errorf("roots %q, want %q", roots, test.want)
+			}
+			if report.Len() != test.errors {
+				t.Errorf("%d errors (%v), want %d", report.Len(), report.Errors(), test.errors)
+			}
+		})
+	}
+}
+
+func TestNormalizeRootsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "data", "a"), 0755)
+	if err := os.Symlink(filepath.Join(dir, "data", "a"), filepath.Join(dir, "link")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+
+	// The link is inside the other root once resolved, whatever the order
+	for _, paths := range [][]string{
+		{filepath.Join(dir, "data"), filepath.Join(dir, "link")},
+		{filepath.Join(dir, "link"), filepath.Join(dir, "data")},
+	} {
+		report := NewErrorReport(BestEffort)
+
+		err, roots := normalizeRoots(nil, paths, report)
+		if err != nil || !reflect.DeepEqual(roots, []string{filepath.Join(dir, "data")}) || report.Len() != 1 {
+			t.Errorf("roots of %q : %q, %v, %v", paths, roots, err, report.Errors())
+		}
+	}
+
+	// The link itself is scanned when it is the outer root
+	err, roots := normalizeRoots(nil, []string{filepath.Join(dir, "link"), filepath.Join(dir, "data", "a")}, NewErrorReport(BestEffort))
+	if err != nil || !reflect.DeepEqual(roots, []string{filepath.Join(dir, "link")}) {
+		t.Errorf("roots %q, %v", roots, err)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		parent string
+		path   string
+		want   bool
+	}{
+		{"data", "data", true},
+		{"data", "data/a", true},
+		{"data", "data/a/b", true},
+		{"data/a", "data/a-b", false},
+		{"data/a", "data", false},
+		{"data", "other", false},
+		{"data", "..data", false},
+	}
+
+	for _, test := range tests {
+		if got := isWithin(test.parent, test.path); got != test.want {
+			t.Errorf("isWithin(%s, %s) = %v, want %v", test.parent, test.path, got, test.want)
+		}
+	}
+}
+
+func TestScanRootsOverlap(t *testing.T) {
+	config := scanTestConfig(t)
+
+	err, result := ScanRoots(context.Background(), []string{"data/b", "data/a", "data/a/sub", "missing"}, config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	for _, project := range result.Projects {
+		got = append(got, project.Root+" in "+project.ScanRoot)
+	}
+
+	// data/a/sub is only found once, in data/a
+	want := []string{"data/a in data/a", "data/a/sub in data/a", "data/b in data/b", "data/b/cgo in data/b"}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(result.Roots, []string{"data/b", "data/a"}) {
+		t.Errorf("projects %q in %q, want %q", got, result.Roots, want)
+	}
+	if len(result.Errors) != 2 {
+		t.Errorf("errors %v, want the missing root and the inner one", result.Errors)
+	}
+}
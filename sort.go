@@ -0,0 +1,221 @@
+package inseki
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortKey : What the projects are sorted by, ties are always broken by root path
+type SortKey string
+
+const (
+	SortByPath      SortKey = "path"      // Root path (default)
+	SortByStructure SortKey = "structure" // Structure ID (the first one of a project)
+	SortByDepth     SortKey = "depth"     // Number of folders in the root path
+	SortBySize      SortKey = "size"      // Total size of the files under the root
+	SortByModTime   SortKey = "mtime"     // Newest modification time under the root
+)
+
+// IsValid : Check if the key is known (an empty key means SortByPath)
+func (k SortKey) IsValid() bool {
+	switch k {
+	case "", SortByPath, SortByStructure, SortByDepth, SortBySize, SortByModTime:
+		return true
+	}
+	return false
+}
+
+// ResultOptions : Order and page of the projects returned by Scan
+type ResultOptions struct {
+	SortBy     SortKey `json:"sortBy,omitempty"`
+	Descending bool    `json:"descending,omitempty"`
+
+	// Page of the sorted projects (gathered by root), ScanResult.Total still counts all of them
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"` // No limit if 0
+}
+
+// SortProjects : Sort the projects in place, by root path unless said otherwise (ties are broken by root path)
+// Sizes and modification times come from the statistics of the projects
+// Projects without statistics are walked from fsys (the OS if nil), once per tree, with the .insekiignore files of their scan root
+func SortProjects(fsys FileSystem, projects []Project, by SortKey, descending bool) error {
+	if !by.IsValid() {
+		return fmt.Errorf("unknown sort key: %s", by)
+	}
+
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+
+	// map[root] = statistics, read only for the projects without them
+	stats := make(map[string]*ProjectStats)
+	if by == SortBySize || by == SortByModTime {
+		missing := make([]Project, 0)
+		for _, project := range projects {
+			if project.Stats != nil {
+				stats[project.Root] = project.Stats
+			} else {
+				missing = append(missing, project)
+			}
+		}
+
+		readProjectsStats(context.Background(), fsys, missing, nil, WalkOptions{}, false, 1, NewErrorReport(BestEffort))
+		for _, project := range missing {
+			if project.Stats != nil {
+				stats[project.Root] = project.Stats
+			}
+		}
+	}
+
+	less := projectLess(by, descending, func(p Project) *ProjectStats { return stats[p.Root] })
+	sort.SliceStable(projects, func(i, j int) bool {
+		return less(projects[i], projects[j])
+	})
+
+	return nil
+}
+
+// projectLess : Order of the projects for a key, statsOf gives the statistics of a project (nil ones count as an empty project)
+// Roots being unique, two different projects are never equal
+func projectLess(by SortKey, descending bool, statsOf func(p Project) *ProjectStats) func(a, b Project) bool {
+	size := func(p Project) int64 {
+		if s := statsOf(p); s != nil {
+			return s.Size
+		}
+		return 0
+	}
+	newest := func(p Project) time.Time {
+		if s := statsOf(p); s != nil {
+			return s.Newest
+		}
+		return time.Time{}
+	}
+
+	// compare : < 0 if a comes first, on the key only
+	compare := func(a, b Project) int {
+		switch by {
+		case "", SortByPath:
+			return strings.Compare(a.Root, b.Root)
+		case SortByStructure:
+			return strings.Compare(firstLabel(a), firstLabel(b))
+		case SortByDepth:
+			return pathDepth(a.Root) - pathDepth(b.Root)
+		case SortBySize:
+			return compareInt64(size(a), size(b))
+		case SortByModTime:
+			return newest(a).Compare(newest(b))
+		}
+		return 0
+	}
+
+	return func(a, b Project) bool {
+		if c := compare(a, b); c != 0 {
+			if descending {
+				return c > 0
+			}
+			return c < 0
+		}
+
+		// Same key : always the same order, whatever the direction
+		return a.Root < b.Root
+	}
+}
+
+// projectWindow : Page of the sorted projects, kept while the projects come in any order
+// Only the first offset+limit projects are held (every project without a limit), total counts them all
+type projectWindow struct {
+	less     func(a, b Project) bool
+	size     int       // 0 : no limit
+	projects []Project // Heap, the last project of the window on top
+	total    int
+}
+
+func newProjectWindow(options ResultOptions, less func(a, b Project) bool) *projectWindow {
+	window := &projectWindow{less: less, projects: make([]Project, 0)}
+
+	if options.Limit > 0 {
+		window.size = max(options.Offset, 0) + options.Limit
+	}
+
+	return window
+}
+
+// add : Offer a project, it is kept if it belongs to the window so far
+func (w *projectWindow) add(project Project) {
+	w.total++
+
+	switch {
+	case w.size == 0 || len(w.projects) < w.size:
+		heap.Push(w, project)
+	case w.less(project, w.projects[0]):
+		w.projects[0] = project
+		heap.Fix(w, 0)
+	}
+}
+
+// page : The projects of the page, sorted
+func (w *projectWindow) page(offset int) []Project {
+	sort.Slice(w.projects, func(i, j int) bool {
+		return w.less(w.projects[i], w.projects[j])
+	})
+	return PageProjects(w.projects, offset, 0)
+}
+
+func (w *projectWindow) Len() int           { return len(w.projects) }
+func (w *projectWindow) Less(i, j int) bool { return w.less(w.projects[j], w.projects[i]) }
+func (w *projectWindow) Swap(i, j int)      { w.projects[i], w.projects[j] = w.projects[j], w.projects[i] }
+func (w *projectWindow) Push(x any)         { w.projects = append(w.projects, x.(Project)) }
+
+func (w *projectWindow) Pop() any {
+	project := w.projects[len(w.projects)-1]
+	w.projects = w.projects[:len(w.projects)-1]
+	return project
+}
+
+// PageProjects : Projects from offset, at most limit of them (all the rest if limit is 0)
+func PageProjects(projects []Project, offset int, limit int) []Project {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(projects) {
+		return []Project{}
+	}
+
+	projects = projects[offset:]
+	if limit > 0 && limit < len(projects) {
+		projects = projects[:limit]
+	}
+
+	return projects
+}
+
+// firstLabel : Smallest structure ID of a project
+func firstLabel(project Project) string {
+	labels := project.Labels()
+	if len(labels) == 0 {
+		return ""
+	}
+
+	sort.Strings(labels)
+	return labels[0]
+}
+
+// pathDepth : Number of folders in a path
+func pathDepth(path string) int {
+	return strings.Count(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+func compareInt64(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package inseki
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPageProjects(t *testing.T) {
+	projects := []Project{{Root: "a"}, {Root: "b"}, {Root: "c"}, {Root: "d"}}
+
+	tests := []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, 0, []string{"a", "b", "c", "d"}},
+		{0, 2, []string{"a", "b"}},
+		{1, 2, []string{"b", "c"}},
+		{3, 2, []string{"d"}},
+		{4, 2, []string{}},
+		{10, 0, []string{}},
+		{-1, 1, []string{"a"}},
+		{2, 0, []string{"c", "d"}},
+	}
+
+	for _, test := range tests {
+		if got := projectRoots(PageProjects(projects, test.offset, test.limit)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("PageProjects(%d, %d) = %q, want %q", test.offset, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestProjectWindow(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	stats := make(map[string]*ProjectStats)
+	projects := make([]Project, 0)
+	for i := 0; i < 50; i++ {
+		root := fmt.Sprintf("p%02d", i)
+		if i%3 == 0 {
+			root += "/nested"
+		}
+		projects = append(projects, Project{
+			Root:       root,
+			Structures: []ProjectStructure{{Structure: Structure{ID: fmt.Sprintf("s%d.json", random.Intn(4))}}},
+		})
+		// Sizes with ties, broken by root path
+		stats[root] = &ProjectStats{Size: int64(random.Intn(5)), Newest: time.Unix(int64(random.Intn(10)), 0)}
+	}
+	statsOf := func(p Project) *ProjectStats { return stats[p.Root] }
+
+	tests := []struct {
+		by     SortKey
+		offset int
+		limit  int
+	}{
+		{SortByPath, 0, 0},
+		{SortByPath, 5, 10},
+		{SortBySize, 0, 1},
+		{SortBySize, 10, 7},
+		{SortByModTime, 3, 3},
+		{SortByStructure, 0, 20},
+		{SortByDepth, 45, 10},
+		{SortBySize, 60, 5},
+	}
+
+	for _, test := range tests {
+		for _, descending := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s %v %d+%d", test.by, descending, test.offset, test.limit), func(t *testing.T) {
+				less := projectLess(test.by, descending, statsOf)
+
+				sorted := append([]Project(nil), projects...)
+				sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+				want := projectRoots(PageProjects(sorted, test.offset, test.limit))
+
+				window := newProjectWindow(ResultOptions{Offset: test.offset, Limit: test.limit}, less)
+				for _, i := range random.Perm(len(projects)) {
+					window.add(projects[i])
+				}
+
+				if got := projectRoots(window.page(test.offset)); !reflect.DeepEqual(got, want) {
+					t.Errorf("page %q, want %q", got, want)
+				}
+				if window.total != len(projects) {
+					t.Errorf("total %d, want %d", window.total, len(projects))
+				}
+				if test.limit > 0 && len(window.projects) > test.offset+test.limit {
+					t.Errorf("%d projects held for a page of %d", len(window.projects), test.limit)
+				}
+			})
+		}
+	}
+}
+
+func TestSortProjects(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fsys := FromFS(fstest.MapFS{
+		"data/small/a.c":     {Data: []byte("a"), ModTime: recent},
+		"data/big/a.c":       {Data: []byte("aaaaaaaaaa"), ModTime: old},
+		"data/big/inner/b.c": {Data: []byte("bbbbbbbbbb"), ModTime: old},
+		"data/medium/a.c":    {Data: []byte("aaaaa"), ModTime: old},
+	})
+
+	projects := func() []Project {
+		return []Project{
+			{Root: "data/small", ScanRoot: "data"},
+			{Root: "data/big", ScanRoot: "data"},
+			{Root: "data/big/inner", ScanRoot: "data"},
+			{Root: "data/medium", ScanRoot: "data", Stats: &ProjectStats{Size: 100}}, // Given statistics are used as they are
+		}
+	}
+
+	tests := []struct {
+		by         SortKey
+		descending bool
+		want       []string
+	}{
+		{SortByPath, false, []string{"data/big", "data/big/inner", "data/medium", "data/small"}},
+		{SortByPath, true, []string{"data/small", "data/medium", "data/big/inner", "data/big"}},
+		{SortByDepth, true, []string{"data/big/inner", "data/big", "data/medium", "data/small"}},
+		{SortBySize, false, []string{"data/small", "data/big/inner", "data/big", "data/medium"}},
+		{SortBySize, true, []string{"data/medium", "data/big", "data/big/inner", "data/small"}},
+		{SortByModTime, true, []string{"data/small", "data/big", "data/big/inner", "data/medium"}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %v", test.by, test.descending), func(t *testing.T) {
+			sorted := projects()
+			if err := SortProjects(fsys, sorted, test.by, test.descending); err != nil {
+				t.Fatal(err)
+			}
+			if got := projectRoots(sorted); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sorted %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if err := SortProjects(fsys, projects(), "color", false); err == nil {
+		t.Errorf("unknown key accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package inseki
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// spillStore : Projects of a scan, written to a temporary file in sorted runs once there are more than threshold in memory
+// A threshold of 0 keeps everything in memory
+// They are read back one at a time, in root order (see compareRoots), without loading the file
+type spillStore struct {
+	dir       string
+	threshold int
+
+	held []Response
+	file *os.File
+	runs []spillRun
+	size int64 // Bytes written to the file
+}
+
+// spillRun : Part of the file holding sorted projects
+type spillRun struct {
+	offset int64
+	length int64
+}
+
+func newSpillStore(options MemoryOptions) *spillStore {
+	store := &spillStore{
+		held: make([]Response, 0),
+	}
+
+	if options.Bounded {
+		store.dir = options.SpillDir
+		store.threshold = options.spillThreshold()
+	}
+
+	return store
+}
+
+// add : Keep projects, the ones held in memory go to the file as a sorted run if there are too many
+// After an error, nothing is lost but the next projects should stay in memory (see keep)
+func (s *spillStore) add(responses []Response) error {
+	s.held = append(s.held, responses...)
+
+	if s.threshold == 0 || len(s.held) <= s.threshold {
+		return nil
+	}
+
+	if s.file == nil {
+		file, err := os.CreateTemp(s.dir, "inseki-*.ndjson")
+		if err != nil {
+			return err
+		}
+
+		s.file = file
+	}
+
+	sortStored(s.held)
+
+	var run bytes.Buffer
+	encoder := json.NewEncoder(&run)
+	for _, response := range s.held {
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.file.WriteAt(run.Bytes(), s.size); err != nil {
+		// The run is dropped from the file, its projects stay in memory
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	s.runs = append(s.runs, spillRun{offset: s.size, length: int64(run.Len())})
+	s.size += int64(run.Len())
+	s.held = s.held[:0]
+
+	return nil
+}
+
+// keep : Stop writing to the file, the next projects stay in memory
+func (s *spillStore) keep() {
+	s.threshold = 0
+}
+
+// each : Call fn on every project kept, in root order then structure ID (the runs of the file are merged)
+// A run that can't be read is left out, the first error is returned once the others are done
+func (s *spillStore) each(fn func(response Response)) error {
+	sortStored(s.held)
+
+	sources := &spillMerge{}
+
+	held := s.held
+	sources.add(func() (bool, Response, error) {
+		if len(held) == 0 {
+			return false, Response{}, nil
+		}
+		response := held[0]
+		held = held[1:]
+		return true, response, nil
+	})
+
+	for _, run := range s.runs {
+		decoder := json.NewDecoder(bufio.NewReader(io.NewSectionReader(s.file, run.offset, run.length)))
+		sources.add(func() (bool, Response, error) {
+			var response Response
+			err := decoder.Decode(&response)
+			if errors.Is(err, io.EOF) {
+				return false, Response{}, nil
+			}
+			return err == nil, response, err
+		})
+	}
+
+	for sources.Len() > 0 {
+		fn(sources.heads[0].response)
+		sources.advance()
+	}
+
+	return sources.err
+}
+
+// close : Remove the temporary file
+func (s *spillStore) close() {
+	if s.file == nil {
+		return
+	}
+
+	s.file.Close()
+	os.Remove(s.file.Name())
+	s.file = nil
+}
+
+// sortStored : Order of the stored projects, a root right before the roots inside it
+func sortStored(responses []Response) {
+	sort.Slice(responses, func(i, j int) bool {
+		return storedBefore(responses[i], responses[j])
+	})
+}
+
+func storedBefore(a Response, b Response) bool {
+	if c := compareRoots(a.Root, b.Root); c != 0 {
+		return c < 0
+	}
+	if a.Structure.ID != b.Structure.ID {
+		return a.Structure.ID < b.Structure.ID
+	}
+	return a.Filepath < b.Filepath
+}
+
+// compareRoots : Compare paths with the separator before any other character,
+// so a folder is directly followed by its content ("/a", "/a/b", "/a-b")
+func compareRoots(a string, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+
+		if a[i] == filepath.Separator {
+			return -1
+		}
+		if b[i] == filepath.Separator {
+			return 1
+		}
+		if a[i] < b[i] {
+			return -1
+		}
+		return 1
+	}
+
+	return len(a) - len(b)
+}
+
+// ----------------------------- Merge -----------------------------
+
+// spillHead : Next project of a sorted source
+type spillHead struct {
+	response Response
+	next     func() (bool, Response, error)
+}
+
+// spillMerge : Heap of the sources, the one with the first project on top
+type spillMerge struct {
+	heads []spillHead
+	err   error
+}
+
+// add : Add a source, unless it is already empty
+func (m *spillMerge) add(next func() (bool, Response, error)) {
+	ok, response, err := next()
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+	if ok {
+		heap.Push(m, spillHead{response: response, next: next})
+	}
+}
+
+// advance : Replace the first project by the next one of its source
+func (m *spillMerge) advance() {
+	ok, response, err := m.heads[0].next()
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+
+	if ok {
+		m.heads[0].response = response
+		heap.Fix(m, 0)
+	} else {
+		heap.Pop(m)
+	}
+}
+
+func (m *spillMerge) Len() int { return len(m.heads) }
+func (m *spillMerge) Less(i, j int) bool {
+	return storedBefore(m.heads[i].response, m.heads[j].response)
+}
+func (m *spillMerge) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+func (m *spillMerge) Push(x any)    { m.heads = append(m.heads, x.(spillHead)) }
+
+func (m *spillMerge) Pop() any {
+	head := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return head
+}
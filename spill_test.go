@@ -0,0 +1,123 @@
+package inseki
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareRoots(t *testing.T) {
+	sep := string(filepath.Separator)
+
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"a", "a", 0},
+		{"a", "b", -1},
+		{"a", "a" + sep + "b", -1},
+		{"a" + sep + "b", "a-b", -1},
+		{"a-b", "a" + sep + "b", 1},
+		{"a" + sep + "z", "a-b", -1},
+		{"a" + sep + "b", "a" + sep + "b" + sep + "c", -1},
+		{"ab", "a" + sep + "c", 1},
+	}
+
+	for _, test := range tests {
+		got := compareRoots(test.a, test.b)
+		if got < 0 {
+			got = -1
+		} else if got > 0 {
+			got = 1
+		}
+		if got != test.want {
+			t.Errorf("compareRoots(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSpillStore(t *testing.T) {
+	sep := string(filepath.Separator)
+
+	// Batches in the order a scan could give them, with a root before and after its content
+	batches := [][]Response{
+		{{Root: "d" + sep + "b", Filepath: "d/b/x.c", Structure: Structure{ID: "c.json"}}},
+		{{Root: "d-b", Filepath: "d-b/y.c", Structure: Structure{ID: "c.json"}}},
+		{
+			{Root: "d", Filepath: "d/go.mod", Structure: Structure{ID: "go.json"}},
+			{Root: "d", Filepath: "d/main.c", Structure: Structure{ID: "c.json"}},
+		},
+		{{Root: "a", Filepath: "a/z.c", Structure: Structure{ID: "c.json"}}},
+		{{Root: "d" + sep + "a", Filepath: "d/a/w.c", Structure: Structure{ID: "c.json"}}},
+	}
+	want := []string{"a c.json", "d c.json", "d go.json", "d" + sep + "a c.json", "d" + sep + "b c.json", "d-b c.json"}
+
+	tests := []struct {
+		name    string
+		options MemoryOptions
+		spilled bool
+	}{
+		{"in memory", MemoryOptions{}, false},
+		{"bounded, under the threshold", MemoryOptions{Bounded: true, SpillThreshold: 10}, false},
+		{"bounded, a run per project", MemoryOptions{Bounded: true, SpillThreshold: 1}, true},
+		{"bounded, a few runs", MemoryOptions{Bounded: true, SpillThreshold: 2}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			test.options.SpillDir = dir
+
+			store := newSpillStore(test.options)
+			for _, batch := range batches {
+				if err := store.add(append([]Response(nil), batch...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if spilled := store.file != nil; spilled != test.spilled {
+				t.Errorf("spilled %v, want %v", spilled, test.spilled)
+			}
+
+			for pass := 0; pass < 2; pass++ {
+				got := make([]string, 0)
+				err := store.each(func(response Response) {
+					got = append(got, fmt.Sprintf("%s %s", response.Root, response.Structure.ID))
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("pass %d: %q, want %q", pass, got, want)
+				}
+			}
+
+			store.close()
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("%d files left after close", len(entries))
+			}
+		})
+	}
+}
+
+func TestSpillStoreKeep(t *testing.T) {
+	store := newSpillStore(MemoryOptions{Bounded: true, SpillThreshold: 1, SpillDir: filepath.Join(t.TempDir(), "missing")})
+
+	// The file can't be created, the projects stay in memory
+	if err := store.add([]Response{{Root: "b"}, {Root: "a"}}); err == nil {
+		t.Fatal("no error without the spill folder")
+	}
+	store.keep()
+	if err := store.add([]Response{{Root: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	store.each(func(response Response) { got = append(got, response.Root) })
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %q, want %q", got, want)
+	}
+}
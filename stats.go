@@ -0,0 +1,370 @@
+package inseki
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProjectStats : Size and content of a project, what du, find and cloc would say
+type ProjectStats struct {
+	Size  int64 `json:"size"` // Bytes of the files
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`  // Folders under the root, the root excluded
+	Lines int   `json:"lines"` // Lines of the text files
+
+	// map[extension] = files with this extension (".c", "" for none)
+	Extensions map[string]ExtensionStats `json:"extensions"`
+
+	Newest time.Time `json:"newest"` // Most recent modification of a file
+	Oldest time.Time `json:"oldest"` // Oldest modification of a file
+}
+
+// ExtensionStats : Files of a project sharing the same extension
+type ExtensionStats struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+	Lines int   `json:"lines"` // 0 for binary files
+}
+
+// ReadProjectStats : Walk a project with the ignore rules and the limits of the scan to compute its statistics
+// Lines are counted in the files that look like text (no NUL byte in their first 8000 bytes, like git does)
+func ReadProjectStats(ctx context.Context, fsys FileSystem, root string, insekiIgnore []string, options WalkOptions, report *ErrorReport) (error, ProjectStats) {
+	if onOS(fsys) {
+		root = TranslateDir(root)
+	}
+	root = filepath.Clean(root)
+
+	err, stats := readTreeStats(ctx, fsys, root, []string{root}, insekiIgnore, options, true, 1, report)
+	if err != nil {
+		return err, ProjectStats{}
+	}
+
+	return nil, *stats[root]
+}
+
+// readProjectsStats : Set the statistics of the projects, walking each tree of projects once per scan root (see readTreeStats)
+// Projects whose tree can't be walked keep nil statistics
+// This walk comes after the scan : the scan only knows a root once it is complete, and counting every folder
+// in case it becomes part of a project would cost as much memory as the tree, and read the files outside of the projects
+func readProjectsStats(ctx context.Context, fsys FileSystem, projects []Project, insekiIgnore []string, options WalkOptions, lines bool, workers int, report *ErrorReport) {
+	byScanRoot := make(map[string][]string)
+	for _, project := range projects {
+		scanRoot := project.ScanRoot
+		if scanRoot == "" {
+			scanRoot = project.Root
+		}
+		byScanRoot[scanRoot] = append(byScanRoot[scanRoot], project.Root)
+	}
+
+	all := make(map[string]*ProjectStats)
+	for scanRoot, roots := range byScanRoot {
+		_, stats := readTreeStats(ctx, fsys, scanRoot, roots, insekiIgnore, options, lines, workers, report)
+		for root, rootStats := range stats {
+			all[root] = rootStats
+		}
+	}
+
+	for i := range projects {
+		projects[i].Stats = all[projects[i].Root]
+	}
+}
+
+/*
+readTreeStats : Statistics of several projects of the same scan root, each file is visited (and read) once
+
+Only the outermost projects are walked, a file counts for every project containing it.
+The ignore rules are the ones of the scan : the global ones apply from scanRoot, as do the ignore files of the
+folders between scanRoot and the projects. MaxDepth counts from scanRoot too.
+Archives are counted as the files they are, their content is not walked again.
+Without lines, the files are not read at all. Up to workers outermost projects are walked at once.
+The error is the one of the last tree that couldn't be walked, its projects are left out of the map.
+*/
+func readTreeStats(ctx context.Context, fsys FileSystem, scanRoot string, roots []string, insekiIgnore []string, options WalkOptions, lines bool, workers int, report *ErrorReport) (error, map[string]*ProjectStats) {
+	scanRoot = filepath.Clean(scanRoot)
+
+	stats := make(map[string]*ProjectStats, len(roots))
+	for _, root := range roots {
+		stats[filepath.Clean(root)] = &ProjectStats{Extensions: make(map[string]ExtensionStats)}
+	}
+
+	sorted := make([]string, 0, len(stats))
+	for root := range stats {
+		sorted = append(sorted, root)
+	}
+	sort.Strings(sorted)
+
+	// Outermost projects, a project inside one of them is counted during its walk
+	outermost := make([]string, 0)
+	for _, root := range sorted {
+		if len(outermost) == 0 || !isWithin(outermost[len(outermost)-1], root) {
+			outermost = append(outermost, root)
+		}
+	}
+
+	// Matchers of the scan root, with the ignore files from the scan root down to the parent of each project
+	matchers := make(map[string]*IgnoreMatcher)
+	loaded := make(map[string]bool)
+	anchors := make([]string, len(outermost))
+
+	for i, outer := range outermost {
+		anchor := scanRoot
+		if !isWithin(scanRoot, outer) {
+			anchor = outer
+		}
+		anchors[i] = anchor
+
+		if matchers[anchor] == nil {
+			matchers[anchor] = NewIgnoreMatcher(fsys, anchor, insekiIgnore, options.GitIgnore)
+		}
+
+		parents := make([]string, 0)
+		for dir := filepath.Dir(outer); outer != anchor && isWithin(anchor, dir); dir = filepath.Dir(dir) {
+			parents = append(parents, dir)
+			if dir == anchor {
+				break
+			}
+		}
+		for j := len(parents) - 1; j >= 0; j-- {
+			if !loaded[parents[j]] {
+				matchers[anchor].LoadDir(parents[j])
+				loaded[parents[j]] = true
+			}
+		}
+	}
+
+	// Each outermost project holds its own projects, so the trees are walked side by side
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var lastErr error
+	failed := make([]string, 0)
+	slots := make(chan struct{}, max(workers, 1))
+
+	for i, outer := range outermost {
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			failed = append(failed, outermost[i:]...)
+			break
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(anchor string, outer string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := walkTreeStats(ctx, fsys, anchor, outer, matchers[anchor], options, lines, stats, report); err != nil {
+				mu.Lock()
+				lastErr = err
+				failed = append(failed, outer)
+				mu.Unlock()
+			}
+		}(anchors[i], outer)
+	}
+
+	wg.Wait()
+
+	for _, outer := range failed {
+		for root := range stats {
+			if isWithin(outer, root) {
+				delete(stats, root)
+			}
+		}
+	}
+
+	return lastErr, stats
+}
+
+// walkTreeStats : Walk the tree of an outermost project, adding each entry to the projects containing it
+func walkTreeStats(ctx context.Context, fsys FileSystem, anchor string, outer string, ignore *IgnoreMatcher, options WalkOptions, lines bool, stats map[string]*ProjectStats, report *ErrorReport) error {
+	if _, err := statRoot(fsys, outer); err != nil {
+		return err
+	}
+
+	// map[folder] = projects containing its entries, only for the folders being walked
+	// (a folder can be left while the callback runs, with several workers)
+	var mu sync.Mutex
+	owners := make(map[string][]*ProjectStats)
+
+	containing := func(dir string) []*ProjectStats {
+		mu.Lock()
+		defer mu.Unlock()
+		return owners[dir]
+	}
+
+	var walkStats WalkStats
+	return exploreTree(ctx, fsys, anchor, outer, ignore, options, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+
+			projects := containing(filepath.Dir(path))
+			if path == outer {
+				projects = nil
+			}
+
+			// The archive itself was counted as a file, its content only counts for the projects it holds
+			if path != outer && isArchiveDir(info) {
+				if !holdsProject(stats, path) {
+					return filepath.SkipDir
+				}
+				projects = nil
+			}
+
+			for _, project := range projects {
+				project.Dirs++
+			}
+
+			if project, ok := stats[path]; ok {
+				projects = append(append([]*ProjectStats(nil), projects...), project)
+			}
+
+			mu.Lock()
+			owners[path] = projects
+			mu.Unlock()
+
+			return nil
+		}
+
+		projects := containing(filepath.Dir(path))
+		if len(projects) == 0 {
+			return nil
+		}
+
+		extension := strings.ToLower(filepath.Ext(path))
+		size := info.Size()
+		modTime := info.ModTime()
+
+		fileLines := 0
+		if lines && info.Mode().IsRegular() {
+			if err, count, text := countFileLines(fsys, path); err != nil {
+				report.Add(path, PhaseWalk, err)
+			} else if text {
+				fileLines = count
+			}
+		}
+
+		for _, project := range projects {
+			byExtension := project.Extensions[extension]
+
+			project.Files++
+			project.Size += size
+			project.Lines += fileLines
+			byExtension.Files++
+			byExtension.Size += size
+			byExtension.Lines += fileLines
+
+			project.Extensions[extension] = byExtension
+
+			if project.Newest.IsZero() || modTime.After(project.Newest) {
+				project.Newest = modTime
+			}
+			if project.Oldest.IsZero() || modTime.Before(project.Oldest) {
+				project.Oldest = modTime
+			}
+		}
+
+		return nil
+	}, func(dir string) {
+		mu.Lock()
+		delete(owners, dir)
+		mu.Unlock()
+	}, &walkStats, report)
+}
+
+// holdsProject : Check if a folder is or holds the root of a project
+func holdsProject(stats map[string]*ProjectStats, dir string) bool {
+	for root := range stats {
+		if isWithin(dir, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// textSniffSize : Bytes checked for a NUL byte to tell text from binary, like git
+const textSniffSize = 8000
+
+// isText : Check if a file looks like text, git checks the first 8000 bytes for a NUL byte
+func isText(data []byte) bool {
+	if len(data) > textSniffSize {
+		data = data[:textSniffSize]
+	}
+	return bytes.IndexByte(data, 0) == -1
+}
+
+// countFileLines : Lines of a file (the last one counts even without a trailing newline), and whether it looks like text
+// Only the beginning of the file is kept in memory, the rest is counted while it is read
+func countFileLines(fsys FileSystem, path string) (error, int, bool) {
+	file, err := openFile(fsys, path)
+	if err != nil {
+		return err, 0, false
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 32*1024)
+
+	head, err := reader.Peek(textSniffSize)
+	if err != nil && err != io.EOF {
+		return err, 0, false
+	}
+	if !isText(head) {
+		return nil, 0, false
+	}
+
+	lines := 0
+	read := 0
+	var last byte
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			lines += bytes.Count(buffer[:n], []byte("\n"))
+			read += n
+			last = buffer[n-1]
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err, 0, false
+		}
+	}
+
+	if read > 0 && last != '\n' {
+		lines++
+	}
+	return nil, lines, true
+}
+
+// forEachProject : Call fn on each project, several projects at once
+func forEachProject(ctx context.Context, projects []Project, workers int, fn func(project *Project)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+
+	for i := range projects {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(project *Project) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			fn(project)
+		}(&projects[i])
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,122 @@
+package inseki
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCountFileLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		lines int
+		text  bool
+	}{
+		{"empty", "", 0, true},
+		{"one line", "a\n", 1, true},
+		{"no trailing newline", "a\nb", 2, true},
+		{"blank lines", "\n\n\n", 3, true},
+		{"windows", "a\r\nb\r\n", 2, true},
+		{"binary", "a\x00b\n", 0, false},
+		{"NUL after the sniffed bytes", strings.Repeat("x\n", 5000) + "\x00", 5001, true},
+		{"longer than the buffer", strings.Repeat("line\n", 20000), 20000, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := FromFS(fstest.MapFS{"file": {Data: []byte(test.data)}})
+
+			err, lines, text := countFileLines(fsys, "file")
+			if err != nil || lines != test.lines || text != test.text {
+				t.Errorf("countFileLines = %d lines, text %v, %v, want %d, %v", lines, text, err, test.lines, test.text)
+			}
+		})
+	}
+}
+
+func TestReadTreeStats(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	fsys := FromFS(fstest.MapFS{
+		"data/.insekiignore":      {Data: []byte("*.log\n")},
+		"data/p/main.c":           {Data: []byte("int main() {\n}\n"), ModTime: day(2)},
+		"data/p/README":           {Data: []byte("readme"), ModTime: day(5)},
+		"data/p/debug.log":        {Data: []byte("ignored\n"), ModTime: day(9)},
+		"data/p/inner/lib.c":      {Data: []byte("a\nb\nc\n"), ModTime: day(3)},
+		"data/p/inner/blob.bin":   {Data: []byte{1, 0, 2, '\n'}, ModTime: day(1)},
+		"data/p/inner/deep/x.C":   {Data: []byte("x\n"), ModTime: day(4)},
+		"data/q/go.mod":           {Data: []byte("module q\n"), ModTime: day(7)},
+		"data/outside/nothing.c":  {Data: []byte("outside\n"), ModTime: day(8)},
+		"data/q/.insekiignore":    {Data: []byte("vendor/\n"), ModTime: day(6)},
+		"data/q/vendor/dep/dep.c": {Data: []byte("dep\n"), ModTime: day(10)},
+	})
+
+	ext := func(files int, size int64, lines int) ExtensionStats {
+		return ExtensionStats{Files: files, Size: size, Lines: lines}
+	}
+
+	withLines := map[string]ProjectStats{
+		"data/p": {Size: 33, Files: 5, Dirs: 2, Lines: 7, Newest: day(5), Oldest: day(1), Extensions: map[string]ExtensionStats{
+			".c": ext(3, 23, 6), "": ext(1, 6, 1), ".bin": ext(1, 4, 0),
+		}},
+		"data/p/inner": {Size: 12, Files: 3, Dirs: 1, Lines: 4, Newest: day(4), Oldest: day(1), Extensions: map[string]ExtensionStats{
+			".c": ext(2, 8, 4), ".bin": ext(1, 4, 0),
+		}},
+		"data/q": {Size: 17, Files: 2, Dirs: 0, Lines: 2, Newest: day(7), Oldest: day(6), Extensions: map[string]ExtensionStats{
+			".mod": ext(1, 9, 1), ".insekiignore": ext(1, 8, 1),
+		}},
+	}
+
+	// Without lines, the files are not read
+	withoutLines := make(map[string]ProjectStats)
+	for root, stats := range withLines {
+		stats.Lines = 0
+		extensions := make(map[string]ExtensionStats)
+		for name, byExtension := range stats.Extensions {
+			byExtension.Lines = 0
+			extensions[name] = byExtension
+		}
+		stats.Extensions = extensions
+		withoutLines[root] = stats
+	}
+
+	tests := []struct {
+		name    string
+		lines   bool
+		workers int
+		options WalkOptions
+		want    map[string]ProjectStats
+	}{
+		{"lines", true, 1, WalkOptions{}, withLines},
+		{"without lines", false, 1, WalkOptions{}, withoutLines},
+		{"parallel walks", true, 4, WalkOptions{Workers: 4}, withLines},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, stats := readTreeStats(context.Background(), fsys, "data", []string{"data/q", "data/p/inner", "data/p"}, nil, test.options, test.lines, test.workers, NewErrorReport(BestEffort))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]ProjectStats)
+			for root, rootStats := range stats {
+				got[root] = *rootStats
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("stats\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+
+	// A missing project is left out, the others are kept
+	err, stats := readTreeStats(context.Background(), fsys, "data", []string{"data/p", "data/missing"}, nil, WalkOptions{}, false, 1, NewErrorReport(BestEffort))
+	if err == nil || stats["data/missing"] != nil || stats["data/p"] == nil {
+		t.Errorf("missing project : %v, %v", err, stats)
+	}
+
+}
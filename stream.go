@@ -0,0 +1,102 @@
+package inseki
+
+import (
+	"context"
+	"iter"
+)
+
+/*
+ScanStream : A scan running in the background, sending each project as soon as its root is complete
+
+A root is complete once every file that could lead to it has been checked against the structures,
+so the projects of a root are deduplicated (or classified with Exclusive) before being sent.
+Parent and Nested are left empty and the nested policy is not applied : they need every project.
+Responses carry no statistics, metadata or git status (Config.ProjectStats, Metadata and Git are ignored),
+they are only computed for the Projects of Scan.
+
+Responses has to be read until it is closed, or the scan stopped with Stop (or its context).
+*/
+type ScanStream struct {
+	Responses <-chan Response
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	result ScanResult
+}
+
+// Stream : Same as Scan, the projects are sent on a channel while the scan goes on
+func Stream(ctx context.Context, path string, config Config, insekiIgnore []string) *ScanStream {
+	return StreamRoots(ctx, []string{path}, config, insekiIgnore)
+}
+
+// StreamRoots : Same as ScanRoots, the projects are sent on a channel while the scan goes on
+func StreamRoots(ctx context.Context, paths []string, config Config, insekiIgnore []string) *ScanStream {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan Response)
+
+	s := &ScanStream{
+		Responses: ch,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	send := func(settled []Response) {
+		for _, response := range settled {
+			select {
+			case ch <- response:
+			case <-ctx.Done():
+				// Nobody reads anymore
+				return
+			}
+		}
+	}
+
+	go func() {
+		defer close(s.done)
+		defer close(ch)
+		defer cancel()
+
+		s.err, s.result = scanRoots(ctx, paths, config, insekiIgnore, send, nil)
+	}()
+
+	return s
+}
+
+// Wait : Wait for the end of the scan, and return its error and its result (without the responses, already sent)
+// Responses not read yet are dropped
+func (s *ScanStream) Wait() (error, ScanResult) {
+	for range s.Responses {
+	}
+	<-s.done
+
+	return s.err, s.result
+}
+
+// Stop : Cancel the scan and wait for its end
+func (s *ScanStream) Stop() {
+	s.cancel()
+	s.Wait()
+}
+
+/*
+All : Iterate over the projects, then over the error of the scan if there is one
+
+	for response, err := range stream.All() { ... }
+
+Breaking out of the loop stops the scan.
+*/
+func (s *ScanStream) All() iter.Seq2[Response, error] {
+	return func(yield func(Response, error) bool) {
+		for response := range s.Responses {
+			if !yield(response, nil) {
+				s.Stop()
+				return
+			}
+		}
+
+		if err, _ := s.Wait(); err != nil {
+			yield(Response{}, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package inseki
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// blockingFileSystem : Waits before reading a folder, until the test lets it go
+type blockingFileSystem struct {
+	FileSystem
+	at       string
+	released chan struct{}
+}
+
+func (f blockingFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	if name == f.at {
+		select {
+		case <-f.released:
+		case <-time.After(10 * time.Second):
+		}
+	}
+
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestStreamRootsIncremental(t *testing.T) {
+	released := make(chan struct{})
+
+	config := scanTestConfig(t)
+	config.FS = blockingFileSystem{
+		FileSystem: FromFS(fstest.MapFS{
+			"data/a/main.c": {Data: []byte("main\n")},
+			"data/z/late.c": {Data: []byte("late\n")},
+		}),
+		at:       "data/z",
+		released: released,
+	}
+	config.Walk.Workers = 1
+
+	stream := StreamRoots(context.Background(), []string{"data"}, config, nil)
+
+	// data/a is sent while the walk waits before data/z
+	select {
+	case response := <-stream.Responses:
+		if response.Root != "data/a" {
+			t.Errorf("first project %s, want data/a", response.Root)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no project sent before the end of the walk")
+	}
+
+	close(released)
+
+	response, ok := <-stream.Responses
+	if !ok || response.Root != "data/z" {
+		t.Errorf("second project %s (%v), want data/z", response.Root, ok)
+	}
+
+	err, result := stream.Wait()
+	if err != nil || result.Responses != nil {
+		t.Errorf("Wait = %v, %d responses", err, len(result.Responses))
+	}
+}
+
+func TestStreamAll(t *testing.T) {
+	config := scanTestConfig(t)
+	want := responseKeys(scanTest(t, config).Responses)
+
+	err, ignore := ReadInsekiIgnore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]Response, 0)
+	for response, err := range Stream(context.Background(), "data", config, ignore).All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, response)
+	}
+
+	// The projects come as their roots are complete, in any order
+	keys := responseKeys(got)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("streamed %q, want %q", keys, want)
+	}
+}
+
+func TestStreamAllBreak(t *testing.T) {
+	stream := Stream(context.Background(), "data", scanTestConfig(t), nil)
+
+	count := 0
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		break
+	}
+
+	// Breaking out stops the scan, and its goroutine is gone once the loop is left
+	select {
+	case <-stream.done:
+	default:
+		t.Fatal("the scan still runs after the loop")
+	}
+	if count != 1 || !errors.Is(stream.err, context.Canceled) {
+		t.Errorf("%d projects, scan error %v", count, stream.err)
+	}
+}
+
+func TestStreamAllError(t *testing.T) {
+	config := scanTestConfig(t)
+	config.FS = failingFileSystem{
+		FileSystem: FromFS(fstest.MapFS{
+			"data/a/main.c":   {Data: []byte("main\n")},
+			"data/m/locked.c": {Data: []byte("locked\n")},
+		}),
+		failing: map[string]bool{"data/m": true},
+	}
+	config.ErrorPolicy = FailFast
+
+	var errs []error
+	last := false
+	for _, err := range Stream(context.Background(), "data", config, nil).All() {
+		if err != nil {
+			errs = append(errs, err)
+			last = true
+		} else if last {
+			t.Error("a project came after the error")
+		}
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], os.ErrPermission) {
+		t.Errorf("errors %v, want the walk of data/m once", errs)
+	}
+}
@@ -1,6 +1,7 @@
 package inseki
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,14 +17,26 @@ type Node struct {
 	Name        string `json:"name"`
 	IsDirectory bool   `json:"isDirectory"`
 	Optional    bool   `json:"optional,omitempty"`
+	MatchAll    bool   `json:"matchAll,omitempty"` // Wildcard directory: every matching folder has to satisfy the children
 	Children    []Node `json:"children,omitempty"`
 	HashValue   uint64 `json:"hash,omitempty"`
 }
 
 type Structure struct {
-	Root Node `json:"root"`
-	Hash uint64
-	Name string
+	Root     Node   `json:"root"`
+	Hash     uint64 `json:"hash"`
+	Name     string `json:"name"`
+	ID       string `json:"id"`                 // Path of the JSON file, relative to the structure folder
+	Priority int    `json:"priority,omitempty"` // Declared with "priority" next to the root node, used to break ties
+
+	// Declared with "extractors" next to the root node, DefaultExtractors if empty
+	Extractors []string `json:"extractors,omitempty"`
+}
+
+// structureHeader : Metadata declared at the top of a structure file, next to the root node
+type structureHeader struct {
+	Priority   int      `json:"priority,omitempty"`
+	Extractors []string `json:"extractors,omitempty"`
 }
 
 /*
@@ -56,7 +69,14 @@ func (s Structure) String() string {
 JSONToStructure method to read a JSON file and return a Structure
 */
 func JSONToStructure(jsonPath string) (error, Structure) {
-	jsonData, err := os.ReadFile(jsonPath)
+	return ReadStructure(OSFileSystem, jsonPath)
+}
+
+/*
+ReadStructure method to read a JSON file from a FileSystem and return a Structure
+*/
+func ReadStructure(fsys FileSystem, jsonPath string) (error, Structure) {
+	jsonData, err := fsys.ReadFile(jsonPath)
 	if err != nil {
 		return err, Structure{}
 	}
@@ -67,28 +87,50 @@ func JSONToStructure(jsonPath string) (error, Structure) {
 		return err, Structure{}
 	}
 
+	var header structureHeader
+	err = json.Unmarshal(jsonData, &header)
+	if err != nil {
+		return err, Structure{}
+	}
+
 	rootNode.HashValue = rootNode.Hash()
 
 	structure := rootNode.NodeToStructure()
 	structure.Name = filepath.Base(jsonPath)
+	structure.ID = structure.Name
+	structure.Priority = header.Priority
+	structure.Extractors = header.Extractors
 
 	return nil, structure
 }
 
 /*
 ImportStructure method to import all structures from a folder
+Invalid, duplicated and conflicting structures are recorded in report, which decides if the import goes on
 */
-func ImportStructure(config Config, insekiIgnore []string, numberFilesAnalysed *int) (error, map[uint64]Structure) {
+func ImportStructure(ctx context.Context, config Config, insekiIgnore []string, numberFilesAnalysed *int, report *ErrorReport) (error, map[uint64]Structure) {
 	nodes := make(map[uint64]Structure)
 
-	path := TranslateDir(config.StructurePath)
+	fsys := config.configFileSystem()
+
+	path := config.StructurePath
+	if onOS(fsys) {
+		path = TranslateDir(path)
+	}
+
+	var stats WalkStats
 
 	// Read all .json
-	err := ExploreFolder(path, insekiIgnore, func(path string, info os.FileInfo) error {
-		if strings.HasSuffix(path, ".json") {
-			err, structure := JSONToStructure(path)
+	err := ExploreFolder(ctx, fsys, path, insekiIgnore, WalkOptions{}, func(file string, info os.FileInfo) error {
+		if strings.HasSuffix(file, ".json") {
+			err, structure := ReadStructure(fsys, file)
 			if err != nil {
-				return err
+				return report.Add(file, PhaseImport, err)
+			}
+
+			// The relative path is unique, unlike the file name
+			if rel, err := filepath.Rel(path, file); err == nil {
+				structure.ID = filepath.ToSlash(rel)
 			}
 
 			// Check if the hash is not in the map, add it
@@ -97,16 +139,18 @@ func ImportStructure(config Config, insekiIgnore []string, numberFilesAnalysed *
 			} else {
 				// If the hash is already in the map, check if the node is equal
 				// If it is equal, then it is a duplicate
-				if nodes[structure.Hash].Equal(structure, false) {
-					return errors.New(fmt.Sprintf("Duplicate: %s\n", path))
+				if nodes[structure.Hash].Equal(structure, true) {
+					return report.Add(file, PhaseImport, errors.New("duplicate of "+nodes[structure.Hash].ID))
 				} else {
 					// If it is not equal, then it is a conflict
-					return errors.New(fmt.Sprintf("Conflict: %s\n", path))
+					return report.Add(file, PhaseImport, errors.New("conflict with "+nodes[structure.Hash].ID))
 				}
 			}
 		}
 		return nil
-	}, numberFilesAnalysed)
+	}, &stats, report)
+
+	*numberFilesAnalysed += stats.FilesAnalysed
 
 	if err != nil {
 		return err, nil
@@ -196,25 +240,66 @@ func (n Node) NodeToString(canBeOptional bool) []string {
 
 /*
 Equal
-See if a node is equal to another node (using hash) :
+See if a node is equal to another node :
+
+If canBeOptional is false, only the required nodes are compared (each one contains the other)
+If canBeOptional is true, optional nodes have to be the same too
 */
 func (n Node) Equal(other Node, canBeOptional bool) bool {
-	// TODO: Check canBeOptional
-	return n.Hash() == other.Hash() && n.Contains(other) && other.Contains(n)
+	if canBeOptional {
+		return n.Hash() == other.Hash() && n.sameTree(other)
+	}
+
+	return n.Contains(other) && other.Contains(n)
+}
+
+// sameTree : Check if two nodes have the same names, kinds and optional flags, whatever the order of the children
+func (n Node) sameTree(other Node) bool {
+	if n.Name != other.Name || n.IsDirectory != other.IsDirectory ||
+		n.Optional != other.Optional || n.MatchAll != other.MatchAll ||
+		len(n.Children) != len(other.Children) {
+		return false
+	}
+
+	used := make([]bool, len(other.Children))
+
+	for _, child := range n.Children {
+		found := false
+		for i, otherChild := range other.Children {
+			if !used[i] && child.sameTree(otherChild) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
 }
 
 /*
 Contains
 See if a node contains another node :
 
-# If all the children of A are in B (where children of B can be optional), then A is in B
+# If all the required children of A are required in B, then A is in B
+
+A.Contains(B) -> A is in B, every folder matching B also matches A
 
-A.Contains(B) -> A is in B
+Names are compared as patterns : "*.c" is in "main.c", as a main.c file is also a *.c file
 */
 func (n Node) Contains(other Node) bool {
 
-	// If the name is different, return false
-	if n.Name != other.Name {
+	// The name of the other node has to be covered by this one
+	if n.IsDirectory != other.IsDirectory || !PatternSubsumes(n.Name, other.Name) {
+		return false
+	}
+
+	// Every matching folder has to satisfy the children, only the same constraint guarantees it
+	if n.MatchAll && (!other.MatchAll || n.Name != other.Name) {
 		return false
 	}
 
@@ -222,17 +307,21 @@ func (n Node) Contains(other Node) bool {
 	if n.IsDirectory {
 		// For each child
 		for _, child := range n.Children {
-			// Check if the child is in the other node
+			// If the child is optional, it doesn't have to be found
+			if child.Optional {
+				continue
+			}
+
+			// Check if the child is in the other node, where it has to be required too
 			found := false
 			for _, otherChild := range other.Children {
-				if child.Contains(otherChild) {
+				if !otherChild.Optional && child.Contains(otherChild) {
 					found = true
 					break
 				}
 			}
 
-			// If the child is not found and it is not optional, return false
-			if !found && !child.Optional {
+			if !found {
 				return false
 			}
 		}
@@ -244,47 +333,7 @@ func (n Node) Contains(other Node) bool {
 
 // Matches : Check if a Structure matches a file with a specific depth
 func (n Node) Matches(root string) bool {
-	// Has to match from the root
-
-	// If the current node is a file
-	if !n.IsDirectory {
-		// Check if the file exists with os.Glob
-		files, _ := filepath.Glob(filepath.Join(root, n.Name))
-		return len(files) > 0
-	}
-
-	// If the current node is a directory
-	// Check if the root is the same as the name
-	if matched, _ := filepath.Match(n.Name, filepath.Base(root)); matched {
-		// Check if the children match (all non optional children need to be present)
-		hasAllChildren := true
-
-		for _, child := range n.Children {
-			// If the child is optional, skip
-			if child.Optional {
-				continue
-			}
-
-			if !child.IsDirectory {
-				// Check if the child is in the root
-				if !child.Matches(root) {
-					hasAllChildren = false
-					break
-				}
-			} else {
-				// Check if the child is in the root
-				if !child.Matches(filepath.Join(root, child.Name)) {
-					hasAllChildren = false
-					break
-				}
-			}
-		}
-
-		return hasAllChildren
-	}
-
-	return false
-
+	return NewMatcher(OSFileSystem).MatchNode(n, root)
 }
 
 func (n Node) GetDepths(filename string, depths *[]uint8, depth int) {
@@ -304,6 +353,21 @@ func (n Node) GetDepths(filename string, depths *[]uint8, depth int) {
 	}
 }
 
+/*
+RequiredNodes
+Number of non-optional nodes under a node (children of an optional node are not counted)
+*/
+func (n Node) RequiredNodes() int {
+	count := 0
+	for _, child := range n.Children {
+		if child.Optional {
+			continue
+		}
+		count += 1 + child.RequiredNodes()
+	}
+	return count
+}
+
 /*
 Hash a node using merkle tree
 */
@@ -313,6 +377,11 @@ func (n Node) Hash(depth ...int) uint64 {
 		for _, child := range n.Children {
 			hash += child.Hash(append(depth, 1)...)
 		}
+
+		// Every matching folder has to satisfy the children : not the same structure
+		if n.MatchAll {
+			hash = hash*31 + uint64(len(depth)) + 1
+		}
 		return hash
 	} else {
 		if len(n.Name) >= 2 {
@@ -422,6 +491,24 @@ func (s Structure) Contains(other Structure) bool {
 	return s.Root.Contains(other.Root)
 }
 
+/*
+Refines
+See if a structure is a refinement of another one : every folder matching it also matches the other
+
+A.Refines(B) <=> B.Contains(A)
+*/
+func (s Structure) Refines(other Structure) bool {
+	return other.Contains(s)
+}
+
+/*
+Specificity
+Number of required nodes of a structure, the more there are the more specific it is
+*/
+func (s Structure) Specificity() int {
+	return s.Root.RequiredNodes()
+}
+
 func (s Structure) GetDepths(filename string) []uint8 {
 	depths := make([]uint8, 0)
 
@@ -433,62 +520,15 @@ func (s Structure) GetDepths(filename string) []uint8 {
 // Matches : Check if a Structure matches a file
 // Returns the root of the structure
 func (s Structure) Matches(path string) (bool, string) {
-	/*
-		The idea is the following :
-
-		We have a Structure, and a match (for example, ~/home/dev/main.c)
-
-		We need to check if **all** folders and files that are non-optional in the structure are contained around this file.
-
-		1. First, we need to determine where is the detected file/folder in the structure (which depth)
-
-		Ex : {
-			README
-			src {
-				main.c
-			}
-		}
-
-		-> main.c is at depth 1 (we need one "../" to go back to the root)
-
-		2. Second, we need to go to the possible root folder
-		3. See if the structure matches from the root
-
-		/!\ There could be multiple depth :
-
-		{
-			README
-			src {
-				main.c
-			}
-			main.c
-		}
-
-		-> main.c is at two different depths
-	*/
-
-	path = filepath.Clean(path)
-
-	// Get the depth of the file
-	depths := s.GetDepths(filepath.Base(path))
-
-	for _, depth := range depths {
-		root := GoUp(path, depth)
-
-		if s.Root.Matches(root) {
-			return true, root
-		}
-	}
-
-	return false, ""
+	return NewMatcher(OSFileSystem).MatchStructure(s, path)
 }
 
 /*
 Equal
-See if a structure is equal to another structure (using hash) :
+See if a structure is equal to another structure (see Node.Equal)
 */
 func (s Structure) Equal(other Structure, canBeOptional bool) bool {
-	return s.Hash == other.Hash && s.Contains(other) && other.Contains(s)
+	return s.Root.Equal(other.Root, canBeOptional)
 }
 
 // ----------------------------- Useful -----------------------------
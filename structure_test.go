@@ -0,0 +1,75 @@
+package inseki
+
+import "testing"
+
+// labNode : A lab folder, "~" before a name makes the file optional
+func labNode(files ...string) Node {
+	node := Node{Name: "*", IsDirectory: true}
+	for _, file := range files {
+		optional := file[0] == '~'
+		if optional {
+			file = file[1:]
+		}
+		node.Children = append(node.Children, Node{Name: file, Optional: optional})
+	}
+	return node
+}
+
+func TestNodeEqual(t *testing.T) {
+	tests := []struct {
+		name          string
+		a             Node
+		b             Node
+		canBeOptional bool
+		want          bool
+	}{
+		{"same", labNode("*.c", "*.h"), labNode("*.c", "*.h"), true, true},
+		{"other order", labNode("*.c", "*.h"), labNode("*.h", "*.c"), true, true},
+		{"optional ignored", labNode("*.c", "~README"), labNode("*.c"), false, true},
+		{"optional compared", labNode("*.c", "~README"), labNode("*.c"), true, false},
+		{"optional flag compared", labNode("*.c", "~*.h"), labNode("*.c", "*.h"), true, false},
+		{"required differs", labNode("*.c", "~*.h"), labNode("*.c", "*.h"), false, false},
+		{"pattern and name", labNode("*.c"), labNode("main.c"), false, false},
+		{"same patterns written twice", labNode("*.c", "*.c"), labNode("*.c"), false, true},
+		{"file and folder", Node{Name: "src", IsDirectory: true}, Node{Name: "src"}, false, false},
+		{"matchAll", Node{Name: "*", IsDirectory: true, Children: []Node{{Name: "TP*", IsDirectory: true, MatchAll: true}}},
+			Node{Name: "*", IsDirectory: true, Children: []Node{{Name: "TP*", IsDirectory: true}}}, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Equal(test.b, test.canBeOptional); got != test.want {
+				t.Errorf("Equal(%v) = %v, want %v", test.canBeOptional, got, test.want)
+			}
+			if got := test.b.Equal(test.a, test.canBeOptional); got != test.want {
+				t.Errorf("reversed, Equal(%v) = %v, want %v", test.canBeOptional, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNodeContains(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Node
+		b    Node
+		want bool
+	}{
+		{"pattern covers name", labNode("*.c"), labNode("main.c"), true},
+		{"name doesn't cover pattern", labNode("main.c"), labNode("*.c"), false},
+		{"fewer requirements", labNode("*.c"), labNode("*.c", "Makefile"), true},
+		{"more requirements", labNode("*.c", "Makefile"), labNode("*.c"), false},
+		{"optional ones don't count", labNode("*.c", "~Makefile"), labNode("*.c"), true},
+		{"optional in the other doesn't count", labNode("Makefile"), labNode("*.c", "~Makefile"), false},
+		{"non-ASCII", labNode("?.c"), labNode("é.c"), true},
+		{"non-ASCII, two chars", labNode("??.c"), labNode("é.c"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Contains(test.b); got != test.want {
+				t.Errorf("Contains = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
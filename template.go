@@ -0,0 +1,334 @@
+package inseki
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFolder : Folder of the report templates, in InsekiPath
+const TemplateFolder = "templates"
+
+/*
+ReportData : What a report template receives as "."
+
+	.Roots       Scanned folders
+	.Total       Projects found, .Projects may only hold a page of them (see Config.Results)
+	.Projects    Projects of the page : .Root, .ScanRoot, .Parent, .Nested, .Structures (.Structure, .Trigger, .Matches),
+	             .Alternatives, .Stats, .Metadata and .Git (nil unless the scan computed them)
+	.Structures  Structures that matched at least one project of the page, by ID
+	.Walk        Counters of the walk
+	.Errors      Errors of the scan : .Path, .Phase and .Err
+	.Generated   When the report was rendered
+*/
+type ReportData struct {
+	Roots      []string
+	Total      int
+	Projects   []Project
+	Structures []ReportStructure
+	Walk       WalkStats
+	Errors     []ScanError
+	Generated  time.Time
+}
+
+// ReportStructure : A structure and the roots of the projects it matched
+type ReportStructure struct {
+	ID    string
+	Name  string
+	Roots []string
+}
+
+// ProjectGroup : Projects sharing the same value of a field (see groupBy)
+type ProjectGroup struct {
+	Key      string
+	Projects []Project
+}
+
+// NewReportData : Data model of the templates, from the result of a scan
+func NewReportData(result ScanResult) ReportData {
+	data := ReportData{
+		Roots:      result.Roots,
+		Total:      result.Total,
+		Projects:   result.Projects,
+		Structures: make([]ReportStructure, 0, len(result.ByStructure)),
+		Walk:       result.Walk,
+		Errors:     result.Errors,
+		Generated:  time.Now(),
+	}
+
+	names := make(map[string]string)
+	for _, project := range result.Projects {
+		for _, structure := range project.Structures {
+			names[structure.Structure.ID] = structure.Structure.Name
+		}
+	}
+
+	for id, roots := range result.ByStructure {
+		data.Structures = append(data.Structures, ReportStructure{ID: id, Name: names[id], Roots: roots})
+	}
+	sort.Slice(data.Structures, func(i, j int) bool {
+		return data.Structures[i].ID < data.Structures[j].ID
+	})
+
+	return data
+}
+
+/*
+TemplateFuncs : Helpers available in the report templates, on top of the built-in ones
+
+	groupBy "field" .Projects     Groups (.Key, .Projects) sorted by key, a project is in each key of a list field (structures, ...)
+	sortBy "field" .Projects      Copy of the projects sorted by a field, missing values last
+	sortByDesc "field" .Projects  Same, in descending order
+	field "name" project          Value of a field of a project
+	humanSize (field "size" .)    Size in bytes as "1.5 MiB", "" for nil (.Stats is nil unless the scan computed it)
+	relPath base path             Path relative to base, unchanged if it can't be
+	join list sep                 strings.Join
+
+Fields are the ones of ProjectField (see ProjectFields)
+Each call returns a new map, which can be extended before parsing a template
+*/
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Templates only understand (value, error), unlike the helpers
+		"groupBy": func(field string, projects []Project) ([]ProjectGroup, error) {
+			err, groups := groupProjectsBy(field, projects)
+			return groups, err
+		},
+		"sortBy": func(field string, projects []Project) ([]Project, error) {
+			err, sorted := sortProjectsBy(field, projects, false)
+			return sorted, err
+		},
+		"sortByDesc": func(field string, projects []Project) ([]Project, error) {
+			err, sorted := sortProjectsBy(field, projects, true)
+			return sorted, err
+		},
+		"field": func(name string, project Project) (interface{}, error) {
+			err, value := ProjectField(name, project)
+			return value, err
+		},
+		"humanSize": humanSize,
+		"relPath":   relPath,
+		"join":      strings.Join,
+	}
+}
+
+/*
+RenderTemplate : Render the result of a scan through a template of InsekiPath/templates (read from Config.ConfigFS)
+Templates whose name ends with .html or .htm (before an optional .tmpl) use html/template, the others text/template
+*/
+func RenderTemplate(w io.Writer, config Config, name string, result ScanResult) error {
+	fsys := config.configFileSystem()
+
+	folder := filepath.Join(config.InsekiPath, TemplateFolder)
+	if onOS(fsys) {
+		folder = TranslateDir(folder)
+	}
+
+	// Only the templates of the folder can be rendered
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("template %s: not in %s", name, folder)
+	}
+
+	content, err := fsys.ReadFile(filepath.Join(folder, name))
+	if err != nil {
+		return err
+	}
+
+	return ExecuteTemplate(w, name, string(content), NewReportData(result))
+}
+
+// ExecuteTemplate : Parse a template with the helpers of TemplateFuncs and render data through it
+// The name chooses between html/template and text/template, like RenderTemplate
+func ExecuteTemplate(w io.Writer, name string, content string, data ReportData) error {
+	var err error
+
+	if isHTMLTemplate(name) {
+		var tmpl *htmltemplate.Template
+		if tmpl, err = htmltemplate.New(filepath.Base(name)).Funcs(htmltemplate.FuncMap(TemplateFuncs())).Parse(content); err == nil {
+			err = tmpl.Execute(w, data)
+		}
+	} else {
+		var tmpl *template.Template
+		if tmpl, err = template.New(filepath.Base(name)).Funcs(TemplateFuncs()).Parse(content); err == nil {
+			err = tmpl.Execute(w, data)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("template %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ListTemplates : Names of the templates of InsekiPath/templates, none if the folder doesn't exist
+func ListTemplates(config Config) (error, []string) {
+	fsys := config.configFileSystem()
+
+	folder := filepath.Join(config.InsekiPath, TemplateFolder)
+	if onOS(fsys) {
+		folder = TranslateDir(folder)
+	}
+
+	entries, err := fsys.ReadDir(folder)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, []string{}
+	}
+	if err != nil {
+		return err, nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return nil, names
+}
+
+func isHTMLTemplate(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".tmpl")
+	return strings.HasSuffix(name, ".html") || strings.HasSuffix(name, ".htm")
+}
+
+// groupProjectsBy : Gather the projects by the text of a field, each element of a list being a key
+func groupProjectsBy(field string, projects []Project) (error, []ProjectGroup) {
+	fn, ok := projectFields[field]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field), nil
+	}
+
+	groups := make(map[string]*ProjectGroup)
+	add := func(key string, project Project) {
+		if groups[key] == nil {
+			groups[key] = &ProjectGroup{Key: key}
+		}
+		groups[key].Projects = append(groups[key].Projects, project)
+	}
+
+	for _, project := range projects {
+		value := fn(project)
+
+		if list, ok := value.([]string); ok {
+			for _, key := range list {
+				add(key, project)
+			}
+			continue
+		}
+
+		add(FieldText(value, ""), project)
+	}
+
+	result := make([]ProjectGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return nil, result
+}
+
+// sortProjectsBy : Copy of the projects sorted by a field, ties broken by root, missing values last
+func sortProjectsBy(field string, projects []Project, descending bool) (error, []Project) {
+	fn, ok := projectFields[field]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field), nil
+	}
+
+	sorted := make([]Project, len(projects))
+	copy(sorted, projects)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := fn(sorted[i]), fn(sorted[j])
+
+		// Missing values are last, whatever the direction
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+
+		if c := compareValues(a, b); c != 0 {
+			if descending {
+				return c > 0
+			}
+			return c < 0
+		}
+
+		return sorted[i].Root < sorted[j].Root
+	})
+
+	return nil, sorted
+}
+
+// compareValues : Compare two values of the same field, lists and strings as text
+func compareValues(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareInt64(int64(a), int64(b.(int)))
+	case int64:
+		return compareInt64(a, b.(int64))
+	case bool:
+		return compareInt64(boolInt(a), boolInt(b.(bool)))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+
+	return strings.Compare(FieldText(a, ","), FieldText(b, ","))
+}
+
+func boolInt(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// humanSize : Size in bytes with a binary unit, like "1.5 MiB"
+func humanSize(size interface{}) string {
+	var bytes int64
+	switch size := size.(type) {
+	case int:
+		bytes = int64(size)
+	case int64:
+		bytes = size
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(size)
+	}
+
+	if bytes < 1024 && bytes > -1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+
+	unit := -1
+	for (value >= 1024 || value <= -1024) && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// relPath : Path relative to base, unchanged if it can't be
+func relPath(base string, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,167 @@
+package inseki
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// reportTestResult : Two projects, only the first one with statistics, metadata and a git status
+func reportTestResult() ScanResult {
+	newest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	return ScanResult{
+		Roots: []string{"/data"},
+		Total: 3,
+		Projects: []Project{
+			{
+				Root:     "/data/app",
+				ScanRoot: "/data",
+				Nested:   []string{"/data/app/lib"},
+				Structures: []ProjectStructure{
+					{Structure: Structure{ID: "go.json", Name: "Go"}, Trigger: "/data/app/go.mod"},
+					{Structure: Structure{ID: "c.json", Name: "C"}, Trigger: "/data/app/main.c"},
+				},
+				Stats:    &ProjectStats{Size: 1536, Files: 2, Newest: newest},
+				Metadata: &Metadata{Name: "app", Description: "Pipes | and\nlines", Dependencies: []Dependency{{Name: "a"}, {Name: "b"}}},
+				Git:      &GitStatus{Branch: "main", Ahead: 1, Dirty: true},
+			},
+			{
+				Root:       "/data/app/lib",
+				ScanRoot:   "/data",
+				Parent:     "/data/app",
+				Structures: []ProjectStructure{{Structure: Structure{ID: "c.json", Name: "C"}, Trigger: "/data/app/lib/x.c"}},
+			},
+		},
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	data := NewReportData(reportTestResult())
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"total", "{{.Total}} {{len .Projects}}", "3 2"},
+		{"groupBy", `{{range groupBy "structures" .Projects}}{{.Key}}:{{len .Projects}} {{end}}`, "c.json:2 go.json:1 "},
+		{"sortByDesc", `{{range sortByDesc "root" .Projects}}{{.Root}} {{end}}`, "/data/app/lib /data/app "},
+		{"missing values last", `{{range sortBy "size" .Projects}}{{.Root}} {{end}}`, "/data/app /data/app/lib "},
+		{"missing values last, descending", `{{range sortByDesc "size" .Projects}}{{.Root}} {{end}}`, "/data/app /data/app/lib "},
+		{"field and humanSize", `{{range .Projects}}[{{field "size" . | humanSize}}]{{end}}`, "[1.5 KiB][]"},
+		{"nil statistics", `{{range .Projects}}[{{with .Stats}}{{humanSize .Size}}{{end}}]{{end}}`, "[1.5 KiB][]"},
+		{"relPath and join", `{{range .Projects}}{{join (field "triggers" .) ","}} {{relPath "/data" .Root}};{{end}}`, "/data/app/go.mod,/data/app/main.c app;/data/app/lib/x.c app/lib;"},
+		{"text not escaped", `{{range .Projects}}{{with .Metadata}}{{.Description}}{{end}}{{end}}`, "Pipes | and\nlines"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := ExecuteTemplate(&output, "report.md", test.template, data); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != test.want {
+				t.Errorf("got %q, want %q", output.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestExecuteTemplateHTML(t *testing.T) {
+	result := reportTestResult()
+	result.Projects[0].Metadata.Description = "<script>"
+
+	for _, name := range []string{"report.html", "report.htm.tmpl", "REPORT.HTML"} {
+		var output bytes.Buffer
+		if err := ExecuteTemplate(&output, name, `{{range .Projects}}{{with .Metadata}}{{.Description}}{{end}}{{end}}`, NewReportData(result)); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != "&lt;script&gt;" {
+			t.Errorf("%s : %q, want it escaped", name, output.String())
+		}
+	}
+}
+
+func TestExecuteTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"syntax", "{{range}}"},
+		{"unknown field", `{{range .Projects}}{{field "colour" .}}{{end}}`},
+		{"unknown function", "{{nothing}}"},
+		{"nil statistics", `{{range .Projects}}{{humanSize .Stats.Size}}{{end}}`},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		err := ExecuteTemplate(&output, "bad.md", test.template, NewReportData(reportTestResult()))
+		if err == nil || !strings.Contains(err.Error(), "bad.md") {
+			t.Errorf("%s : error %v", test.name, err)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	funcs := TemplateFuncs()
+	delete(funcs, "humanSize")
+
+	if _, ok := TemplateFuncs()["humanSize"]; !ok {
+		t.Error("a change to the map is seen by the next call")
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size interface{}
+		want string
+	}{
+		{nil, ""},
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{int64(1024), "1.0 KiB"},
+		{int64(1536), "1.5 KiB"},
+		{int64(5 << 30), "5.0 GiB"},
+		{int64(-2048), "-2.0 KiB"},
+		{"text", "text"},
+	}
+
+	for _, test := range tests {
+		if got := humanSize(test.size); got != test.want {
+			t.Errorf("humanSize(%v) = %q, want %q", test.size, got, test.want)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	config := Config{
+		InsekiPath: "inseki",
+		ConfigFS: FromFS(fstest.MapFS{
+			"inseki/templates/count.md":     {Data: []byte("{{.Total}} projects")},
+			"inseki/templates/list.html":    {Data: []byte("{{range .Projects}}<li>{{.Root}}</li>{{end}}")},
+			"inseki/templates/sub/skip.txt": {},
+		}),
+	}
+
+	err, names := ListTemplates(config)
+	if err != nil || strings.Join(names, ",") != "count.md,list.html" {
+		t.Errorf("templates %v, %v", names, err)
+	}
+
+	var output bytes.Buffer
+	if err := RenderTemplate(&output, config, "count.md", reportTestResult()); err != nil || output.String() != "3 projects" {
+		t.Errorf("count.md : %q, %v", output.String(), err)
+	}
+
+	if err := RenderTemplate(&output, config, "missing.md", reportTestResult()); err == nil {
+		t.Error("missing template rendered")
+	}
+
+	// Without a templates folder
+	if err, names := ListTemplates(Config{InsekiPath: "none", ConfigFS: config.ConfigFS}); err != nil || len(names) != 0 {
+		t.Errorf("templates %v, %v", names, err)
+	}
+}
@@ -0,0 +1,472 @@
+package inseki
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+readTOML : TOML reader, enough for the manifests
+Returns map[table][key] = raw value (as written, see tomlString, tomlStrings and tomlInlineTable to read it)
+
+  - Sub-tables and dotted keys are joined with "." : [dependencies.serde] and serde.version = "1.0" in [dependencies]
+    both give the table "dependencies.serde"
+  - Each table of an array of tables ([[bin]]) is its own table, numbered from 0 : "bin[0]", "bin[1]", ...
+  - Strings, arrays and inline tables can span several lines and hold # or commas
+
+Lines that can't be read are skipped, the rest of the document is still read.
+*/
+func readTOML(data []byte) map[string]map[string]string {
+	tables := map[string]map[string]string{"": {}}
+	arrays := make(map[string]int) // map[array of tables] = tables so far
+
+	scanner := &tomlScanner{data: string(data)}
+	table := ""
+
+	for {
+		scanner.skipBlank()
+		if scanner.done() {
+			break
+		}
+
+		start := scanner.pos
+
+		if scanner.peek() == '[' {
+			if name, array, ok := scanner.header(); ok {
+				table = name
+				if array {
+					table = name + "[" + strconv.Itoa(arrays[name]) + "]"
+					arrays[name]++
+				}
+				if tables[table] == nil {
+					tables[table] = make(map[string]string)
+				}
+			}
+		} else if key, value, ok := scanner.keyValue(); ok {
+			name := table
+			if len(key) > 1 {
+				name = joinTOMLKey(table, strings.Join(key[:len(key)-1], "."))
+			}
+			if tables[name] == nil {
+				tables[name] = make(map[string]string)
+			}
+			tables[name][key[len(key)-1]] = value
+		}
+
+		// Anything left on the line is an error, skipped with it
+		scanner.skipLine()
+		if scanner.pos == start {
+			scanner.pos++
+		}
+	}
+
+	return tables
+}
+
+func joinTOMLKey(table string, key string) string {
+	if table == "" {
+		return key
+	}
+	return table + "." + key
+}
+
+// tomlScanner : Position in a TOML document
+type tomlScanner struct {
+	data string
+	pos  int
+}
+
+func (s *tomlScanner) done() bool {
+	return s.pos >= len(s.data)
+}
+
+func (s *tomlScanner) peek() byte {
+	if s.done() {
+		return 0
+	}
+	return s.data[s.pos]
+}
+
+// skipSpace : Skip the spaces and tabs
+func (s *tomlScanner) skipSpace() {
+	for !s.done() && (s.peek() == ' ' || s.peek() == '\t') {
+		s.pos++
+	}
+}
+
+// skipBlank : Skip spaces, line breaks and comments
+func (s *tomlScanner) skipBlank() {
+	for !s.done() {
+		switch s.peek() {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		case '#':
+			s.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine : Go to the beginning of the next line
+func (s *tomlScanner) skipLine() {
+	if i := strings.IndexByte(s.data[s.pos:], '\n'); i >= 0 {
+		s.pos += i + 1
+	} else {
+		s.pos = len(s.data)
+	}
+}
+
+// header : [table] or [[array of tables]], the scanner is left after it
+func (s *tomlScanner) header() (string, bool, bool) {
+	array := strings.HasPrefix(s.data[s.pos:], "[[")
+	if array {
+		s.pos += 2
+	} else {
+		s.pos++
+	}
+
+	s.skipSpace()
+	key, ok := s.key()
+	if !ok {
+		return "", false, false
+	}
+	s.skipSpace()
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(s.data[s.pos:], closing) {
+		return "", false, false
+	}
+	s.pos += len(closing)
+
+	return strings.Join(key, "."), array, true
+}
+
+// keyValue : key = value, the value is returned as written
+func (s *tomlScanner) keyValue() ([]string, string, bool) {
+	key, ok := s.key()
+	if !ok {
+		return nil, "", false
+	}
+
+	s.skipSpace()
+	if s.peek() != '=' {
+		return nil, "", false
+	}
+	s.pos++
+	s.skipSpace()
+
+	value, ok := s.value()
+	return key, value, ok
+}
+
+// key : Parts of a dotted key, bare or quoted
+func (s *tomlScanner) key() ([]string, bool) {
+	parts := make([]string, 0, 1)
+
+	for {
+		s.skipSpace()
+
+		switch s.peek() {
+		case '"', '\'':
+			raw, ok := s.value()
+			if !ok {
+				return nil, false
+			}
+			parts = append(parts, tomlString(raw))
+
+		default:
+			start := s.pos
+			for !s.done() && isBareKeyChar(s.peek()) {
+				s.pos++
+			}
+			if s.pos == start {
+				return nil, false
+			}
+			parts = append(parts, s.data[start:s.pos])
+		}
+
+		s.skipSpace()
+		if s.peek() != '.' {
+			return parts, true
+		}
+		s.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value : A value as written (string, array, inline table or anything else up to the end of the line)
+func (s *tomlScanner) value() (string, bool) {
+	start := s.pos
+	rest := s.data[s.pos:]
+
+	switch {
+	case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, `'''`):
+		delimiter := rest[:3]
+		s.pos += 3
+		for !s.done() {
+			if delimiter == `"""` && s.peek() == '\\' {
+				s.pos += 2
+				continue
+			}
+			if strings.HasPrefix(s.data[s.pos:], delimiter) {
+				s.pos += 3
+				// Up to two quotes can end the content ("""a"""")
+				for i := 0; i < 2 && s.peek() == delimiter[0]; i++ {
+					s.pos++
+				}
+				return s.data[start:s.pos], true
+			}
+			s.pos++
+		}
+		return "", false
+
+	case strings.HasPrefix(rest, `"`), strings.HasPrefix(rest, `'`):
+		quote := rest[0]
+		s.pos++
+		for !s.done() && s.peek() != '\n' {
+			c := s.peek()
+			if c == '\\' && quote == '"' {
+				s.pos += 2
+				continue
+			}
+			s.pos++
+			if c == quote {
+				return s.data[start:s.pos], true
+			}
+		}
+		return "", false
+
+	case strings.HasPrefix(rest, "["):
+		s.pos++
+		for {
+			s.skipBlank()
+			if s.done() {
+				return "", false
+			}
+			if s.peek() == ']' {
+				s.pos++
+				return s.data[start:s.pos], true
+			}
+
+			if _, ok := s.value(); !ok {
+				return "", false
+			}
+
+			s.skipBlank()
+			if s.peek() == ',' {
+				s.pos++
+			} else if s.peek() != ']' {
+				return "", false
+			}
+		}
+
+	case strings.HasPrefix(rest, "{"):
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.peek() == '}' {
+				s.pos++
+				return s.data[start:s.pos], true
+			}
+
+			if _, _, ok := s.keyValue(); !ok {
+				return "", false
+			}
+
+			s.skipSpace()
+			if s.peek() == ',' {
+				s.pos++
+			} else if s.peek() != '}' {
+				return "", false
+			}
+		}
+	}
+
+	// Number, boolean, date : up to what ends a value
+	for !s.done() && !strings.ContainsRune(",]}#\r\n", rune(s.peek())) {
+		s.pos++
+	}
+
+	value := strings.TrimSpace(s.data[start:s.pos])
+	return value, value != ""
+}
+
+// tomlString : Value of a TOML string, escapes resolved ("" if it is something else)
+func tomlString(value string) string {
+	value = strings.TrimSpace(value)
+
+	for _, delimiter := range []string{`"""`, `'''`} {
+		if len(value) >= 6 && strings.HasPrefix(value, delimiter) && strings.HasSuffix(value, delimiter) {
+			content := value[3 : len(value)-3]
+
+			// A line break right after the opening delimiter is not part of the string
+			content = strings.TrimPrefix(strings.TrimPrefix(content, "\r"), "\n")
+
+			if delimiter == `'''` {
+				return content
+			}
+			return unescapeTOML(content, true)
+		}
+	}
+
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return unescapeTOML(value[1:len(value)-1], false)
+	}
+
+	return ""
+}
+
+// unescapeTOML : Resolve the escapes of a basic string, a backslash ending a line of a multi-line one joins the lines
+func unescapeTOML(content string, multiLine bool) string {
+	var result strings.Builder
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c != '\\' || i+1 >= len(content) {
+			result.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch content[i] {
+		case 'n':
+			result.WriteByte('\n')
+		case 't':
+			result.WriteByte('\t')
+		case 'r':
+			result.WriteByte('\r')
+		case 'b':
+			result.WriteByte('\b')
+		case 'f':
+			result.WriteByte('\f')
+		case '"', '\\':
+			result.WriteByte(content[i])
+
+		case 'u', 'U':
+			size := 4
+			if content[i] == 'U' {
+				size = 8
+			}
+			if i+size < len(content) {
+				if code, err := strconv.ParseUint(content[i+1:i+1+size], 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+					result.WriteRune(rune(code))
+					i += size
+					continue
+				}
+			}
+			result.WriteByte('\\')
+			result.WriteByte(content[i])
+
+		default:
+			// Line ending backslash : the line break and the spaces after it are dropped
+			rest := strings.TrimLeft(content[i:], " \t")
+			if multiLine && (strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n")) {
+				trimmed := strings.TrimLeft(rest, " \t\r\n")
+				i = len(content) - len(trimmed) - 1
+				continue
+			}
+			result.WriteByte('\\')
+			result.WriteByte(content[i])
+		}
+	}
+
+	return result.String()
+}
+
+// tomlStrings : Strings of a TOML array, the other items are left out
+func tomlStrings(value string) []string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return nil
+	}
+
+	scanner := &tomlScanner{data: value, pos: 1}
+	values := make([]string, 0)
+
+	for {
+		scanner.skipBlank()
+		if scanner.done() || scanner.peek() == ']' {
+			return values
+		}
+
+		item, ok := scanner.value()
+		if !ok {
+			return values
+		}
+		if s := tomlString(item); s != "" {
+			values = append(values, s)
+		}
+
+		scanner.skipBlank()
+		if scanner.peek() == ',' {
+			scanner.pos++
+		}
+	}
+}
+
+// tomlInlineTable : Keys of an inline table ({ version = "1.0", features = ["derive"] }) with their raw value
+func tomlInlineTable(value string) map[string]string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") {
+		return nil
+	}
+
+	scanner := &tomlScanner{data: value, pos: 1}
+	table := make(map[string]string)
+
+	for {
+		scanner.skipSpace()
+		if scanner.done() || scanner.peek() == '}' {
+			return table
+		}
+
+		key, item, ok := scanner.keyValue()
+		if !ok {
+			return table
+		}
+		table[strings.Join(key, ".")] = item
+
+		scanner.skipSpace()
+		if scanner.peek() == ',' {
+			scanner.pos++
+		}
+	}
+}
+
+// tomlVersion : Version of a dependency, written as a string or in an inline table ({ version = "1.0" })
+func tomlVersion(value string) string {
+	if version := tomlString(value); version != "" {
+		return version
+	}
+	return tomlString(tomlInlineTable(value)["version"])
+}
+
+// tomlDependencies : Dependencies of a table, name = version, or in their own sub-table ([dependencies.serde])
+func tomlDependencies(tables map[string]map[string]string, name string) []Dependency {
+	versions := make(map[string]string)
+
+	for key, value := range tables[name] {
+		versions[key] = tomlVersion(value)
+	}
+
+	prefix := name + "."
+	for table, values := range tables {
+		dependency, ok := strings.CutPrefix(table, prefix)
+		if ok && dependency != "" && !strings.Contains(dependency, ".") {
+			versions[dependency] = tomlString(values["version"])
+		}
+	}
+
+	return sortedDependencies(versions)
+}
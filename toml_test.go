@@ -0,0 +1,198 @@
+package inseki
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadTOML(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		table string
+		key   string
+		want  string // Decoded with tomlString
+	}{
+		{"top level", `name = "a"`, "", "name", "a"},
+		{"table", "[package]\nname = \"inseki\"", "package", "name", "inseki"},
+		{"comment after value", "[package]\nname = \"inseki\" # the name", "package", "name", "inseki"},
+		{"hash in basic string", "[package]\nurl = \"https://x.org/#top\"", "package", "url", "https://x.org/#top"},
+		{"hash in literal string", "[package]\nurl = 'https://x.org/#top' # comment", "package", "url", "https://x.org/#top"},
+		{"escaped quote", `v = "say \"hi\" # not a comment"`, "", "v", `say "hi" # not a comment`},
+		{"unicode escape", `v = "caf\u00e9"`, "", "v", "café"},
+		{"literal keeps backslashes", `v = 'C:\path'`, "", "v", `C:\path`},
+		{"multi-line basic string", "v = \"\"\"\nfirst\nsecond\"\"\"", "", "v", "first\nsecond"},
+		{"multi-line literal string", "v = '''\n# not a comment\n'''", "", "v", "# not a comment\n"},
+		{"line ending backslash", "v = \"\"\"\none \\\n    two\"\"\"", "", "v", "one two"},
+		{"sub-table", "[dependencies.serde]\nversion = \"1.0\"", "dependencies.serde", "version", "1.0"},
+		{"dotted key", "[dependencies]\nserde.version = \"1.0\"", "dependencies.serde", "version", "1.0"},
+		{"quoted key", "[tool]\n\"my.key\" = \"x\"", "tool", "my.key", "x"},
+		{"spaces in header", "[ tool . poetry ]\nname = \"p\"", "tool.poetry", "name", "p"},
+		{"array of tables", "[[bin]]\nname = \"a\"\n[[bin]]\nname = \"b\"", "bin[1]", "name", "b"},
+		{"after array of tables", "[[bin]]\nname = \"a\"\n[package]\nname = \"p\"", "package", "name", "p"},
+		{"after a broken line", "[package]\n= nothing\nname = \"p\"", "package", "name", "p"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tables := readTOML([]byte(test.data))
+			if got := tomlString(tables[test.table][test.key]); got != test.want {
+				t.Errorf("[%s] %s = %q, want %q (tables %v)", test.table, test.key, got, test.want, tables)
+			}
+		})
+	}
+}
+
+func TestReadTOMLArrayOfTablesIsNotATable(t *testing.T) {
+	tables := readTOML([]byte("[[bin]]\nname = \"a\"\n"))
+
+	if _, ok := tables["bin"]; ok {
+		t.Errorf("[[bin]] read as the table bin: %v", tables)
+	}
+	if tomlString(tables["bin[0]"]["name"]) != "a" {
+		t.Errorf("bin[0] = %v", tables["bin[0]"])
+	}
+}
+
+func TestTOMLStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"one line", `["a", "b"]`, []string{"a", "b"}},
+		{"empty", `[]`, []string{}},
+		{"commas in strings", `["requests>=2,<3", 'b']`, []string{"requests>=2,<3", "b"}},
+		{"brackets in strings", `["requests[security]", "x]"]`, []string{"requests[security]", "x]"}},
+		{"other items left out", `["a", 1, true]`, []string{"a"}},
+		{"not an array", `"a"`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tomlStrings(test.value); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tomlStrings(%s) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadTOMLMultiLineArray(t *testing.T) {
+	data := `[project]
+dependencies = [
+    "requests>=2.0,<3", # HTTP
+    'rich',
+    # "commented",
+    "click[extra]",
+]
+name = "after"
+`
+	tables := readTOML([]byte(data))
+
+	want := []string{"requests>=2.0,<3", "rich", "click[extra]"}
+	if got := tomlStrings(tables["project"]["dependencies"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("dependencies = %q, want %q", got, want)
+	}
+	if got := tomlString(tables["project"]["name"]); got != "after" {
+		t.Errorf("name after the array = %q", got)
+	}
+}
+
+func TestTOMLVersion(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`"1.0"`, "1.0"},
+		{`{ version = "1.2", features = ["derive", "rc"] }`, "1.2"},
+		{`{ features = ["a,b"], version = '0.3' }`, "0.3"},
+		{`{ path = "../local" }`, ""},
+	}
+
+	for _, test := range tests {
+		if got := tomlVersion(test.value); got != test.want {
+			t.Errorf("tomlVersion(%s) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestExtractTOMLManifests(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"cargo/Cargo.toml": {Data: []byte(`[package]
+name = "tool"
+version = "0.1.0"
+description = 'A tool # with a hash'
+
+[[bin]]
+name = "other-name"
+
+[dependencies]
+clap = { version = "4", features = ["derive"] }
+anyhow = "1"
+tokio.version = "1.3"
+
+[dependencies.serde]
+version = "1.0"
+features = ["derive"]
+
+[dev-dependencies]
+pretty = "0.1"
+`)},
+		"poetry/pyproject.toml": {Data: []byte(`[tool.poetry]
+name = "app"
+version = "2.0"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+requests = "^2.31"
+
+[tool.poetry.dependencies.django]
+version = "^5.0"
+extras = ["bcrypt"]
+`)},
+		"pep621/pyproject.toml": {Data: []byte(`[project]
+name = "lib"
+version = "1.0"
+dependencies = [
+  "numpy>=1.24,<2",
+  "pandas",
+]
+`)},
+	})
+
+	tests := []struct {
+		root      string
+		extractor string
+		name      string
+		version   string
+		desc      string
+		deps      []Dependency
+	}{
+		{"cargo", "cargo", "tool", "0.1.0", "A tool # with a hash", []Dependency{
+			{Name: "anyhow", Version: "1"}, {Name: "clap", Version: "4"}, {Name: "serde", Version: "1.0"}, {Name: "tokio", Version: "1.3"},
+		}},
+		{"poetry", "python", "app", "2.0", "", []Dependency{
+			{Name: "django", Version: "^5.0"}, {Name: "requests", Version: "^2.31"},
+		}},
+		{"pep621", "python", "lib", "1.0", "", []Dependency{
+			{Name: "numpy", Version: ">=1.24,<2"}, {Name: "pandas"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.root, func(t *testing.T) {
+			err, metadata := ExtractMetadata(fsys, test.root, []string{test.extractor})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if metadata.Name != test.name || metadata.Version != test.version || metadata.Description != test.desc {
+				t.Errorf("got %q %q %q, want %q %q %q", metadata.Name, metadata.Version, metadata.Description, test.name, test.version, test.desc)
+			}
+			if !reflect.DeepEqual(metadata.Dependencies, test.deps) {
+				t.Errorf("dependencies = %v, want %v", metadata.Dependencies, test.deps)
+			}
+		})
+	}
+}
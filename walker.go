@@ -0,0 +1,341 @@
+package inseki
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+walkFileSystem : Walk a tree like filepath.Walk, through a FileSystem
+
+The callback is called on a folder before its content is read (so SkipDir avoids reading it),
+then a second time with the error if the folder can't be read.
+SkipDir on a file skips the rest of its folder, SkipAll stops the walk.
+
+  - workers <= 1 : a single goroutine, in lexical order
+  - deterministic : same order as a single goroutine, sub folders are read ahead by the workers
+  - otherwise : folders are read and visited by the workers in any order
+
+In every case the callback is never called concurrently.
+Entries are given as they are listed : their size, mode and times are only read (lstat on the OS) when asked (see entryInfo).
+leave (if not nil) is called once a folder given to the callback is done : its content was visited, skipped or unreadable.
+*/
+func walkFileSystem(fsys FileSystem, root string, workers int, deterministic bool, fn filepath.WalkFunc, leave func(dir string)) error {
+	info, err := statRoot(fsys, root)
+
+	if err != nil {
+		err = fn(root, nil, err)
+	} else if workers > 1 && !deterministic {
+		err = newWalker(fsys, workers, fn, leave).walkUnordered(root, info)
+	} else {
+		err = newWalker(fsys, workers, fn, leave).walkOrdered(root, info, &listing{dir: root})
+	}
+
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	fsys  FileSystem
+	fn    filepath.WalkFunc
+	leave func(dir string)
+
+	// Free slots to read folders ahead (ordered) or workers (unordered)
+	workers int
+	slots   chan struct{}
+}
+
+func newWalker(fsys FileSystem, workers int, fn filepath.WalkFunc, leave func(dir string)) *walker {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &walker{
+		fsys:    fsys,
+		fn:      fn,
+		leave:   leave,
+		workers: workers,
+		slots:   make(chan struct{}, workers-1),
+	}
+}
+
+// left : A folder given to the callback is done
+func (w *walker) left(dir string) {
+	if w.leave != nil {
+		w.leave(dir)
+	}
+}
+
+// ----------------------------- Ordered -----------------------------
+
+// listing : Content of a folder, read at most once, possibly ahead of time
+type listing struct {
+	once    sync.Once
+	dir     string
+	entries []fs.DirEntry
+	err     error
+}
+
+func (l *listing) read(fsys FileSystem) {
+	l.once.Do(func() {
+		l.entries, l.err = fsys.ReadDir(l.dir)
+	})
+}
+
+// prefetch : Read a folder in the background if a worker is free, otherwise it will be read when visited
+func (w *walker) prefetch(l *listing) {
+	select {
+	case w.slots <- struct{}{}:
+		go func() {
+			defer func() { <-w.slots }()
+			l.read(w.fsys)
+		}()
+	default:
+	}
+}
+
+func (w *walker) walkOrdered(path string, info fs.FileInfo, l *listing) error {
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+
+	defer w.left(path)
+
+	if err := w.fn(path, info, nil); err != nil {
+		return err
+	}
+
+	l.read(w.fsys)
+	if l.err != nil {
+		// The callback decides what to do, the content is skipped anyway
+		return w.fn(path, info, l.err)
+	}
+
+	// Start reading the sub folders while the first ones are visited
+	children := make([]*listing, len(l.entries))
+	for i, entry := range l.entries {
+		children[i] = &listing{dir: filepath.Join(path, entry.Name())}
+		if entry.IsDir() {
+			w.prefetch(children[i])
+		}
+	}
+
+	for i, entry := range l.entries {
+		filename := children[i].dir
+		fileInfo := newEntryInfo(entry)
+
+		err := w.walkOrdered(filename, fileInfo, children[i])
+		if err != nil {
+			// SkipDir from a file skips the rest of its folder
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ----------------------------- Unordered -----------------------------
+
+// walkItem : A folder waiting to be read
+type walkItem struct {
+	path string
+	info fs.FileInfo
+}
+
+// walkQueue : Folders shared by the workers
+type walkQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []walkItem
+	pending int // Folders queued or being read
+	stopped bool
+	err     error
+}
+
+func (q *walkQueue) stop(err error) {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		q.err = err
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (w *walker) walkUnordered(root string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		return w.fn(root, info, nil)
+	}
+
+	if err := w.fn(root, info, nil); err != nil {
+		w.left(root)
+		return err
+	}
+
+	queue := &walkQueue{items: []walkItem{{path: root, info: info}}, pending: 1}
+	queue.cond = sync.NewCond(&queue.mu)
+
+	// The callback is never called concurrently
+	var callbackMu sync.Mutex
+	call := func(path string, info fs.FileInfo, err error) (error, bool) {
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+
+		queue.mu.Lock()
+		stopped := queue.stopped
+		queue.mu.Unlock()
+		if stopped {
+			return nil, false
+		}
+
+		return w.fn(path, info, err), true
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				queue.mu.Lock()
+				for len(queue.items) == 0 && queue.pending > 0 && !queue.stopped {
+					queue.cond.Wait()
+				}
+				if queue.stopped || len(queue.items) == 0 {
+					queue.mu.Unlock()
+					return
+				}
+
+				item := queue.items[len(queue.items)-1]
+				queue.items = queue.items[:len(queue.items)-1]
+				queue.mu.Unlock()
+
+				dirs := w.readUnordered(item, call, queue)
+				w.left(item.path)
+
+				queue.mu.Lock()
+				queue.items = append(queue.items, dirs...)
+				queue.pending += len(dirs) - 1
+				queue.cond.Broadcast()
+				queue.mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if queue.err == filepath.SkipAll {
+		return nil
+	}
+	return queue.err
+}
+
+// readUnordered : Read a folder, call the callback on its content and return the sub folders to read
+func (w *walker) readUnordered(item walkItem, call func(string, fs.FileInfo, error) (error, bool), queue *walkQueue) []walkItem {
+	entries, err := w.fsys.ReadDir(item.path)
+	if err != nil {
+		if err, ok := call(item.path, item.info, err); ok && err != nil && err != filepath.SkipDir {
+			queue.stop(err)
+		}
+		return nil
+	}
+
+	dirs := make([]walkItem, 0)
+
+	for _, entry := range entries {
+		filename := filepath.Join(item.path, entry.Name())
+		fileInfo := newEntryInfo(entry)
+
+		err, ok := call(filename, fileInfo, nil)
+		if !ok {
+			return nil
+		}
+
+		// A folder that is not queued is already done
+		if fileInfo.IsDir() && err != nil {
+			w.left(filename)
+		}
+
+		if err == filepath.SkipDir {
+			// SkipDir from a file skips the rest of its folder
+			if !fileInfo.IsDir() {
+				break
+			}
+			continue
+		}
+
+		if err != nil {
+			queue.stop(err)
+			return nil
+		}
+
+		if fileInfo.IsDir() {
+			dirs = append(dirs, walkItem{path: filename, info: fileInfo})
+		}
+	}
+
+	return dirs
+}
+
+// ----------------------------- Entries -----------------------------
+
+// entryInfo : FileInfo of a directory entry, read from the filesystem the first time more than its name and type is asked
+// An entry removed in the meantime has a zero size and time
+type entryInfo struct {
+	entry fs.DirEntry
+
+	once sync.Once
+	info fs.FileInfo
+}
+
+func newEntryInfo(entry fs.DirEntry) *entryInfo {
+	return &entryInfo{entry: entry}
+}
+
+func (e *entryInfo) load() fs.FileInfo {
+	e.once.Do(func() {
+		if info, err := e.entry.Info(); err == nil {
+			e.info = info
+		}
+	})
+	return e.info
+}
+
+func (e *entryInfo) Name() string { return e.entry.Name() }
+func (e *entryInfo) IsDir() bool  { return e.entry.IsDir() }
+
+func (e *entryInfo) Mode() fs.FileMode {
+	if info := e.load(); info != nil {
+		return info.Mode()
+	}
+	return e.entry.Type()
+}
+
+func (e *entryInfo) Size() int64 {
+	if info := e.load(); info != nil {
+		return info.Size()
+	}
+	return 0
+}
+
+func (e *entryInfo) ModTime() time.Time {
+	if info := e.load(); info != nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+func (e *entryInfo) Sys() any {
+	if info := e.load(); info != nil {
+		return info.Sys()
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package inseki
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func walkerTestFS() FileSystem {
+	return FromFS(fstest.MapFS{
+		"root/a/1.txt":       {},
+		"root/a/2.txt":       {},
+		"root/a/b/3.txt":     {},
+		"root/a-b/4.txt":     {},
+		"root/c/skip/5.txt":  {},
+		"root/c/6.txt":       {},
+		"root/d/e/f/7.txt":   {},
+		"root/z.txt":         {},
+		"root/empty/.keep":   {},
+		"root/stop/0.txt":    {},
+		"root/stop/stop.txt": {},
+		"root/stop/x.txt":    {},
+	})
+}
+
+// walkFileSystem with the callback of the tests : SkipDir on the "skip" folder and on "stop.txt"
+func walkTest(t *testing.T, workers int, deterministic bool) ([]string, []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	visited := make([]string, 0)
+	left := make([]string, 0)
+
+	err := walkFileSystem(walkerTestFS(), "root", workers, deterministic, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		visited = append(visited, filepath.ToSlash(path))
+
+		if info.Name() == "skip" || info.Name() == "stop.txt" {
+			return filepath.SkipDir
+		}
+		return nil
+	}, func(dir string) {
+		mu.Lock()
+		left = append(left, filepath.ToSlash(dir))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return visited, left
+}
+
+func TestWalkFileSystemOrder(t *testing.T) {
+	want, _ := walkTest(t, 1, false)
+
+	for i, path := range want {
+		if path == "root/c/skip/5.txt" || path == "root/stop/x.txt" {
+			t.Errorf("visited %s after SkipDir", path)
+		}
+		if i > 0 && want[i-1] > path && filepath.Dir(want[i-1]) == filepath.Dir(path) {
+			t.Errorf("%s visited after %s", path, want[i-1])
+		}
+	}
+
+	tests := []struct {
+		name          string
+		workers       int
+		deterministic bool
+		ordered       bool
+	}{
+		{"one worker, deterministic", 1, true, true},
+		{"workers, deterministic", 4, true, true},
+		{"workers, unordered", 4, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for run := 0; run < 20; run++ {
+				got, _ := walkTest(t, test.workers, test.deterministic)
+
+				if !test.ordered {
+					sort.Strings(got)
+					sorted := append([]string(nil), want...)
+					sort.Strings(sorted)
+					if !reflect.DeepEqual(got, sorted) {
+						t.Fatalf("visited %v, want %v", got, sorted)
+					}
+					continue
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("visited %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkFileSystemLeave(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       int
+		deterministic bool
+		ordered       bool
+	}{
+		{"one worker", 1, false, true},
+		{"workers, deterministic", 4, true, true},
+		{"workers, unordered", 4, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			visited, left := walkTest(t, test.workers, test.deterministic)
+
+			// Every folder given to the callback is left once
+			dirs := make([]string, 0)
+			for _, path := range visited {
+				if filepath.Ext(path) == "" {
+					dirs = append(dirs, path)
+				}
+			}
+
+			sortedLeft := append([]string(nil), left...)
+			sort.Strings(dirs)
+			sort.Strings(sortedLeft)
+			if !reflect.DeepEqual(sortedLeft, dirs) {
+				t.Errorf("left %v, want %v", sortedLeft, dirs)
+			}
+
+			// Unordered, a folder is done once its own entries are visited
+			if test.ordered && left[len(left)-1] != "root" {
+				t.Errorf("root left before %s", left[len(left)-1])
+			}
+		})
+	}
+}
+
+func TestWalkFileSystemStop(t *testing.T) {
+	stop := errors.New("stop")
+
+	tests := []struct {
+		name          string
+		workers       int
+		deterministic bool
+		result        error
+		want          error
+	}{
+		{"error, one worker", 1, false, stop, stop},
+		{"error, unordered", 4, false, stop, stop},
+		{"SkipAll, one worker", 1, false, filepath.SkipAll, nil},
+		{"SkipAll, deterministic", 4, true, filepath.SkipAll, nil},
+		{"SkipAll, unordered", 4, false, filepath.SkipAll, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			after := 0
+			stopped := false
+
+			err := walkFileSystem(walkerTestFS(), "root", test.workers, test.deterministic, func(path string, info fs.FileInfo, err error) error {
+				if stopped {
+					after++
+				}
+				if info != nil && info.Name() == "b" {
+					stopped = true
+					return test.result
+				}
+				return nil
+			}, nil)
+
+			if err != test.want {
+				t.Errorf("walkFileSystem = %v, want %v", err, test.want)
+			}
+			if after > 0 {
+				t.Errorf("callback called %d times after stopping", after)
+			}
+		})
+	}
+}
+
+func TestWalkFileSystemMissingRoot(t *testing.T) {
+	var got error
+
+	err := walkFileSystem(walkerTestFS(), "missing", 1, false, func(path string, info fs.FileInfo, err error) error {
+		got = err
+		return err
+	}, nil)
+
+	if !errors.Is(got, fs.ErrNotExist) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("callback error %v, walk error %v, want fs.ErrNotExist", got, err)
+	}
+}